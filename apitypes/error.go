@@ -1,8 +1,17 @@
 package apitypes
 
+import gperr "github.com/yusing/goutils/errs"
+
 type ErrorResponse struct {
 	Message string `json:"message"`
 	Error   string `json:"error,omitempty" extensions:"x-nullable"`
+	// Code is the code attached to the error with gperr.WithCode, if any.
+	Code string `json:"code,omitempty" extensions:"x-nullable"`
+	// Status is the HTTP status attached to the error with gperr.WithCode,
+	// if any.
+	Status int `json:"status,omitempty" extensions:"x-nullable"`
+	// Details is the structure of the error, see gperr.Details.
+	Details *gperr.Detail `json:"details,omitempty" extensions:"x-nullable"`
 } // @name ErrorResponse
 
 type serverError struct {
@@ -11,18 +20,25 @@ type serverError struct {
 }
 
 // Error returns a generic error response
+//
+// When err is given, the response also carries its structure and the code
+// and HTTP status attached with gperr.WithCode, if any, so clients can branch
+// on the code instead of the message:
+//
+//	c.JSON(gperr.HTTPStatus(err), apitypes.Error("failed to load route", err))
 func Error(message string, err ...error) ErrorResponse {
-	if len(err) > 0 {
-		if plain, ok := err[0].(interface{ Plain() []byte }); ok {
-			return ErrorResponse{
-				Message: message,
-				Error:   string(plain.Plain()),
-			}
-		}
-		return ErrorResponse{
+	if len(err) > 0 && err[0] != nil {
+		resp := ErrorResponse{
 			Message: message,
-			Error:   err[0].Error(),
+			Details: gperr.Details(err[0]),
+		}
+		resp.Code, resp.Status = gperr.CodeOf(err[0])
+		if plain, ok := err[0].(interface{ Plain() []byte }); ok {
+			resp.Error = string(plain.Plain())
+		} else {
+			resp.Error = err[0].Error()
 		}
+		return resp
 	}
 	return ErrorResponse{
 		Message: message,
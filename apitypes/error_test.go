@@ -0,0 +1,42 @@
+package apitypes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+func TestError(t *testing.T) {
+	require.Equal(t, ErrorResponse{Message: "foo"}, Error("foo"))
+	require.Equal(t, ErrorResponse{Message: "foo"}, Error("foo", nil))
+
+	resp := Error("foo", errors.New("bar"))
+	require.Equal(t, "bar", resp.Error)
+	require.Empty(t, resp.Code)
+	require.Zero(t, resp.Status, "no status without a code")
+	require.Equal(t, &gperr.Detail{Message: "bar"}, resp.Details)
+
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), `"status"`)
+}
+
+func TestErrorCode(t *testing.T) {
+	err := gperr.WithCode(gperr.New("route not found"), "route_not_found", http.StatusNotFound).Subject("example.com")
+
+	resp := Error("failed to load route", err)
+	require.Equal(t, "failed to load route", resp.Message)
+	require.Equal(t, "example.com: route not found", resp.Error)
+	require.Equal(t, "route_not_found", resp.Code)
+	require.Equal(t, http.StatusNotFound, resp.Status)
+	require.Equal(t, &gperr.Detail{
+		Subjects: []string{"example.com"},
+		Message:  "route not found",
+		Code:     "route_not_found",
+		Status:   http.StatusNotFound,
+	}, resp.Details)
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"fmt"
+	"math/rand/v2"
 	"sync/atomic"
 	"testing"
 
@@ -113,6 +114,62 @@ func BenchmarkCacheKeyCleanupOverflow(b *testing.B) {
 	}
 }
 
+// BenchmarkCacheKeyEvictionPolicyHitRatio compares the hit ratio of the
+// eviction policies on a Zipfian trace and on a Zipfian trace interleaved
+// with one-off scans. The ratio is reported as the hit-ratio metric.
+func BenchmarkCacheKeyEvictionPolicyHitRatio(b *testing.B) {
+	const (
+		capacity = 1000
+		keySpace = 100_000
+		traceLen = 200_000
+	)
+	traces := []struct {
+		name string
+		keys []int
+	}{
+		{"zipf", makeZipfKeys(traceLen, keySpace)},
+		{"scan", makeScanKeys(traceLen, keySpace, 2*capacity)},
+	}
+	policies := []struct {
+		name    string
+		factory EvictionPolicyFactory[int]
+	}{
+		{"default", nil},
+		{"lru", NewLRUPolicy[int]},
+		{"lfu", NewLFUPolicy[int]},
+		{"tinylfu", NewTinyLFUPolicy[int]},
+	}
+
+	for _, trace := range traces {
+		for _, policy := range policies {
+			b.Run(trace.name+"/"+policy.name, func(b *testing.B) {
+				builder := NewKeyFunc(func(ctx context.Context, key int) (int, error) {
+					return key, nil
+				}).WithMaxEntries(capacity)
+				if policy.factory != nil {
+					builder = builder.WithEvictionPolicy(policy.factory)
+				}
+				cachedFunc, handle := builder.BuildWithHandle()
+				// unregister from Janitor so repeated runs do not pile up states
+				b.Cleanup(handle.Close)
+
+				ctx := b.Context()
+				var idx int
+				b.ReportAllocs()
+				for b.Loop() {
+					_, _ = cachedFunc(ctx, trace.keys[idx%len(trace.keys)])
+					idx++
+					// evict synchronously so the ratio does not depend on janitor timing
+					if handle.state.entries.Size() > capacity {
+						handle.state.Cleanup()
+					}
+				}
+				b.ReportMetric(handle.Stats().HitRatio(), "hit-ratio")
+			})
+		}
+	}
+}
+
 type benchmarkKeyedConfig struct {
 	name    string
 	builder func(fn CachedContextKeyFunc[int, int]) CachedContextKeyFunc[int, int]
@@ -209,3 +266,26 @@ func makeSkewedKeys(total, hotSet, coldSet, hotPercent int) []int {
 	}
 	return keys
 }
+
+func makeZipfKeys(total, keySpace int) []int {
+	zipf := rand.NewZipf(rand.New(rand.NewPCG(1, 2)), 1.01, 1, uint64(keySpace-1))
+	keys := make([]int, total)
+	for i := range total {
+		keys[i] = int(zipf.Uint64())
+	}
+	return keys
+}
+
+// makeScanKeys interleaves a Zipfian trace with bursts of scanLen keys that
+// are each accessed exactly once.
+func makeScanKeys(total, keySpace, scanLen int) []int {
+	keys := makeZipfKeys(total, keySpace)
+	next := keySpace
+	for start := scanLen; start+scanLen <= total; start += 4 * scanLen {
+		for i := range scanLen {
+			keys[start+i] = next
+			next++
+		}
+	}
+	return keys
+}
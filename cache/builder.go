@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff/v5"
+	"github.com/yusing/goutils/mockable"
+	"github.com/yusing/goutils/task"
 )
 
 type (
@@ -13,15 +15,27 @@ type (
 )
 
 type CachedFuncConfig struct {
+	name           string
 	retries        int
 	backoff        backoff.BackOff
 	backoffFactory func() backoff.BackOff
 	ttl            time.Duration
+	staleGrace     time.Duration
+	errorTTL       time.Duration
+	cacheErrorIf   func(error) bool
+	retryIf        func(error) bool
+	retryBudget    time.Duration
+	entryTTL       bool // expiry is set per value rather than by ttl, see Map
+	clock          mockable.Clock
 }
 
 type CachedFuncBuilder[T any] struct {
 	CachedFuncConfig
 
+	refreshAhead   float64
+	onRefreshError func(err error)
+	parent         task.Parent
+
 	fn CachedContextFunc[T]
 }
 
@@ -30,6 +44,13 @@ type CachedKeyFuncBuilder[T any, K comparable] struct {
 
 	maxEntries      int
 	cleanupInterval time.Duration
+	evictionPolicy  EvictionPolicyFactory[K]
+	maxCost         int64
+	costFn          func(key K, value T) int64
+	onEvict         func(key K, value T, reason EvictReason)
+	parent          task.Parent
+	codec           SnapshotCodec
+	snapshotPath    string
 
 	fn CachedContextKeyFunc[T, K]
 }
@@ -98,6 +119,92 @@ func (builder CachedKeyFuncBuilder[T, K]) WithRetriesZeroBackoff(retries int) Ca
 	return builder
 }
 
+// WithRetriesFullJitterBackoff configures new CachedFuncBuilder instance to
+// retry failed refreshes up to retries times, each time waiting a random
+// delay between 0 and base doubled per attempt, capped at maxDelay. Negative
+// delays are treated as 0 and a maxDelay below base is raised to base.
+func (builder CachedFuncBuilder[T]) WithRetriesFullJitterBackoff(retries int, base, maxDelay time.Duration) CachedFuncBuilder[T] {
+	base, maxDelay = jitterBounds(base, maxDelay)
+	builder.retries = retries
+	builder.backoffFactory = func() backoff.BackOff {
+		return &fullJitterBackOff{base: base, max: maxDelay}
+	}
+	return builder
+}
+
+// WithRetriesFullJitterBackoff configures new CachedKeyFuncBuilder instance to
+// retry failed refreshes up to retries times, each time waiting a random
+// delay between 0 and base doubled per attempt, capped at maxDelay. Negative
+// delays are treated as 0 and a maxDelay below base is raised to base.
+func (builder CachedKeyFuncBuilder[T, K]) WithRetriesFullJitterBackoff(retries int, base, maxDelay time.Duration) CachedKeyFuncBuilder[T, K] {
+	base, maxDelay = jitterBounds(base, maxDelay)
+	builder.retries = retries
+	builder.backoffFactory = func() backoff.BackOff {
+		return &fullJitterBackOff{base: base, max: maxDelay}
+	}
+	return builder
+}
+
+// WithRetriesDecorrelatedJitterBackoff configures new CachedFuncBuilder
+// instance to retry failed refreshes up to retries times, each time waiting a
+// random delay between base and three times the previous delay, capped at
+// maxDelay. Negative delays are treated as 0 and a maxDelay below base is
+// raised to base.
+func (builder CachedFuncBuilder[T]) WithRetriesDecorrelatedJitterBackoff(retries int, base, maxDelay time.Duration) CachedFuncBuilder[T] {
+	base, maxDelay = jitterBounds(base, maxDelay)
+	builder.retries = retries
+	builder.backoffFactory = func() backoff.BackOff {
+		return &decorrelatedJitterBackOff{base: base, max: maxDelay}
+	}
+	return builder
+}
+
+// WithRetriesDecorrelatedJitterBackoff configures new CachedKeyFuncBuilder
+// instance to retry failed refreshes up to retries times, each time waiting a
+// random delay between base and three times the previous delay, capped at
+// maxDelay. Negative delays are treated as 0 and a maxDelay below base is
+// raised to base.
+func (builder CachedKeyFuncBuilder[T, K]) WithRetriesDecorrelatedJitterBackoff(retries int, base, maxDelay time.Duration) CachedKeyFuncBuilder[T, K] {
+	base, maxDelay = jitterBounds(base, maxDelay)
+	builder.retries = retries
+	builder.backoffFactory = func() backoff.BackOff {
+		return &decorrelatedJitterBackOff{base: base, max: maxDelay}
+	}
+	return builder
+}
+
+// WithRetryIf configures new CachedFuncBuilder instance to retry only the
+// errors accepted by retryIf. Other errors, such as not found or validation
+// failures, are returned right away.
+func (builder CachedFuncBuilder[T]) WithRetryIf(retryIf func(error) bool) CachedFuncBuilder[T] {
+	builder.retryIf = retryIf
+	return builder
+}
+
+// WithRetryIf configures new CachedKeyFuncBuilder instance to retry only the
+// errors accepted by retryIf. Other errors, such as not found or validation
+// failures, are returned right away.
+func (builder CachedKeyFuncBuilder[T, K]) WithRetryIf(retryIf func(error) bool) CachedKeyFuncBuilder[T, K] {
+	builder.retryIf = retryIf
+	return builder
+}
+
+// WithRetryBudget configures new CachedFuncBuilder instance to give up
+// retrying once the next attempt would start more than budget after the
+// first one.
+func (builder CachedFuncBuilder[T]) WithRetryBudget(budget time.Duration) CachedFuncBuilder[T] {
+	builder.retryBudget = budget
+	return builder
+}
+
+// WithRetryBudget configures new CachedKeyFuncBuilder instance to give up
+// retrying once the next attempt would start more than budget after the
+// first one.
+func (builder CachedKeyFuncBuilder[T, K]) WithRetryBudget(budget time.Duration) CachedKeyFuncBuilder[T, K] {
+	builder.retryBudget = budget
+	return builder
+}
+
 func (builder CachedFuncBuilder[T]) WithTTL(ttl time.Duration) CachedFuncBuilder[T] {
 	builder.ttl = ttl
 	return builder
@@ -108,6 +215,83 @@ func (builder CachedKeyFuncBuilder[T, K]) WithTTL(ttl time.Duration) CachedKeyFu
 	return builder
 }
 
+// WithErrorTTL configures new CachedFuncBuilder instance to keep cached
+// errors for errorTTL instead of the TTL used for successful results.
+func (builder CachedFuncBuilder[T]) WithErrorTTL(errorTTL time.Duration) CachedFuncBuilder[T] {
+	builder.errorTTL = errorTTL
+	return builder
+}
+
+// WithErrorTTL configures new CachedKeyFuncBuilder instance to keep cached
+// errors for errorTTL instead of the TTL used for successful results.
+func (builder CachedKeyFuncBuilder[T, K]) WithErrorTTL(errorTTL time.Duration) CachedKeyFuncBuilder[T, K] {
+	builder.errorTTL = errorTTL
+	return builder
+}
+
+// WithCacheErrorIf configures new CachedFuncBuilder instance to cache only
+// the errors for which cacheIf returns true. Other errors are returned to
+// the caller and the next call runs the function again.
+func (builder CachedFuncBuilder[T]) WithCacheErrorIf(cacheIf func(error) bool) CachedFuncBuilder[T] {
+	builder.cacheErrorIf = cacheIf
+	return builder
+}
+
+// WithCacheErrorIf configures new CachedKeyFuncBuilder instance to cache only
+// the errors for which cacheIf returns true. Other errors are returned to
+// the caller and the next call runs the function again.
+func (builder CachedKeyFuncBuilder[T, K]) WithCacheErrorIf(cacheIf func(error) bool) CachedKeyFuncBuilder[T, K] {
+	builder.cacheErrorIf = cacheIf
+	return builder
+}
+
+// WithStaleWhileRevalidate configures new CachedFuncBuilder instance to keep
+// serving an expired value for up to grace after its TTL while a single
+// background refresh replaces it. TTL must be set for this to have any effect.
+func (builder CachedFuncBuilder[T]) WithStaleWhileRevalidate(grace time.Duration) CachedFuncBuilder[T] {
+	builder.staleGrace = grace
+	return builder
+}
+
+// WithStaleWhileRevalidate configures new CachedKeyFuncBuilder instance to keep
+// serving an expired entry for up to grace after its TTL while a single
+// background refresh per key replaces it. TTL must be set for this to have any
+// effect.
+func (builder CachedKeyFuncBuilder[T, K]) WithStaleWhileRevalidate(grace time.Duration) CachedKeyFuncBuilder[T, K] {
+	builder.staleGrace = grace
+	return builder
+}
+
+// WithRefreshAhead configures new CachedFuncBuilder instance to refresh the
+// value in the background once fraction of its TTL has passed, e.g. 0.8, so
+// callers never wait for it to load. The first value is loaded right after
+// Build. A failed refresh keeps the cached value, is reported to
+// WithOnRefreshError, and is retried until the value expires. TTL must be set
+// and fraction must be in (0, 1) for this to have any effect.
+//
+// Refreshes run on a subtask of the WithTask parent, or of the root task, and
+// stop when it is canceled.
+func (builder CachedFuncBuilder[T]) WithRefreshAhead(fraction float64) CachedFuncBuilder[T] {
+	builder.refreshAhead = fraction
+	return builder
+}
+
+// WithOnRefreshError configures new CachedFuncBuilder instance to call
+// onRefreshError when a background refresh scheduled by WithRefreshAhead
+// fails. Without it, failures are logged.
+func (builder CachedFuncBuilder[T]) WithOnRefreshError(onRefreshError func(err error)) CachedFuncBuilder[T] {
+	builder.onRefreshError = onRefreshError
+	return builder
+}
+
+// WithTask configures new CachedFuncBuilder instance to run the refreshes
+// scheduled by WithRefreshAhead on a subtask of parent, and to close the
+// cache, see FuncHandle.Close, once parent is canceled.
+func (builder CachedFuncBuilder[T]) WithTask(parent task.Parent) CachedFuncBuilder[T] {
+	builder.parent = parent
+	return builder
+}
+
 // WithMaxEntries configures new CachedKeyFuncBuilder instance with
 // the given maxEntries.
 func (builder CachedKeyFuncBuilder[T, K]) WithMaxEntries(maxEntries int) CachedKeyFuncBuilder[T, K] {
@@ -115,9 +299,82 @@ func (builder CachedKeyFuncBuilder[T, K]) WithMaxEntries(maxEntries int) CachedK
 	return builder
 }
 
+// WithMaxCost configures new CachedKeyFuncBuilder instance to evict entries
+// once the total cost of the cached values exceeds maxCost, on top of any
+// WithMaxEntries limit. cost is called once per stored value and cached
+// errors cost nothing. A nil cost charges the length of []byte and string
+// values and 1 for anything else.
+func (builder CachedKeyFuncBuilder[T, K]) WithMaxCost(maxCost int64, cost func(key K, value T) int64) CachedKeyFuncBuilder[T, K] {
+	if cost == nil {
+		cost = defaultCost[K, T]
+	}
+	builder.maxCost = maxCost
+	builder.costFn = cost
+	return builder
+}
+
+func defaultCost[K comparable, T any](_ K, value T) int64 {
+	switch v := any(value).(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	default:
+		return 1
+	}
+}
+
+// WithOnEvict configures new CachedKeyFuncBuilder instance to call onEvict
+// whenever a cached value leaves the cache, so the resources it holds can be
+// released. Each value is reported once: when it expires, is evicted for
+// capacity, is invalidated through the handle, or is replaced. Expired entries
+// are dropped by the janitor once they can no longer be served stale. Cached
+// errors are not reported.
+//
+// onEvict runs outside the cache's locks and may call back into it. A panic
+// in onEvict is recovered and logged.
+func (builder CachedKeyFuncBuilder[T, K]) WithOnEvict(onEvict func(key K, value T, reason EvictReason)) CachedKeyFuncBuilder[T, K] {
+	builder.onEvict = onEvict
+	return builder
+}
+
+// WithTask configures new CachedKeyFuncBuilder instance to close the cache,
+// see KeyFuncHandle.Close, once parent is canceled. Use it for caches that
+// live as long as a route or a reloadable component rather than the program.
+func (builder CachedKeyFuncBuilder[T, K]) WithTask(parent task.Parent) CachedKeyFuncBuilder[T, K] {
+	builder.parent = parent
+	return builder
+}
+
+// WithSnapshotCodec configures new CachedKeyFuncBuilder instance to encode
+// snapshots with codec instead of JSONSnapshotCodec.
+func (builder CachedKeyFuncBuilder[T, K]) WithSnapshotCodec(codec SnapshotCodec) CachedKeyFuncBuilder[T, K] {
+	builder.codec = codec
+	return builder
+}
+
+// WithSnapshotFile configures new CachedKeyFuncBuilder instance to restore
+// the snapshot at path when built, and to save a snapshot there on
+// task.OnProgramExit, or before closing the cache when WithTask is used. A
+// missing file is not an error; failures are logged.
+func (builder CachedKeyFuncBuilder[T, K]) WithSnapshotFile(path string) CachedKeyFuncBuilder[T, K] {
+	builder.snapshotPath = path
+	return builder
+}
+
+// WithEvictionPolicy configures new CachedKeyFuncBuilder instance to pick
+// the entries to evict with the policy created by factory, such as
+// NewLRUPolicy, NewLFUPolicy or NewTinyLFUPolicy. MaxEntries or MaxCost must
+// be set for this to have any effect. Without a policy, the least recently touched
+// entries are evicted.
+func (builder CachedKeyFuncBuilder[T, K]) WithEvictionPolicy(factory EvictionPolicyFactory[K]) CachedKeyFuncBuilder[T, K] {
+	builder.evictionPolicy = factory
+	return builder
+}
+
 // WithCleanupInterval configures new CachedKeyFuncBuilder instance with
-// the given cleanupInterval. MaxEntries must be set for this to have
-// any effect.
+// the given cleanupInterval. MaxEntries or MaxCost must be set for this to
+// have any effect.
 func (builder CachedKeyFuncBuilder[T, K]) WithCleanupInterval(cleanupInterval time.Duration) CachedKeyFuncBuilder[T, K] {
 	if cleanupInterval < time.Second {
 		cleanupInterval = time.Second
@@ -126,14 +383,98 @@ func (builder CachedKeyFuncBuilder[T, K]) WithCleanupInterval(cleanupInterval ti
 	return builder
 }
 
+// WithName configures new CachedFuncBuilder instance with the given name.
+// Named caches are registered for RegisteredStats and WritePrometheus when
+// built; a later cache with the same name replaces the earlier one.
+func (builder CachedFuncBuilder[T]) WithName(name string) CachedFuncBuilder[T] {
+	builder.name = name
+	return builder
+}
+
+// WithName configures new CachedKeyFuncBuilder instance with the given name.
+// Named caches are registered for RegisteredStats and WritePrometheus when
+// built; a later cache with the same name replaces the earlier one.
+func (builder CachedKeyFuncBuilder[T, K]) WithName(name string) CachedKeyFuncBuilder[T, K] {
+	builder.name = name
+	return builder
+}
+
+// WithClock configures new CachedFuncBuilder instance to tell the time with
+// clock instead of the real clock, for TTLs, retry backoff and refresh-ahead.
+func (builder CachedFuncBuilder[T]) WithClock(clock mockable.Clock) CachedFuncBuilder[T] {
+	builder.clock = clock
+	return builder
+}
+
+// WithClock configures new CachedKeyFuncBuilder instance to tell the time
+// with clock instead of the real clock, for TTLs, retry backoff and the
+// janitor's cleanups.
+func (builder CachedKeyFuncBuilder[T, K]) WithClock(clock mockable.Clock) CachedKeyFuncBuilder[T, K] {
+	builder.clock = clock
+	return builder
+}
+
 func (builder CachedFuncBuilder[T]) Build() CachedContextFunc[T] {
-	state := CachedFuncState[T]{
+	fn, _ := builder.BuildWithHandle()
+	return fn
+}
+
+func (builder CachedKeyFuncBuilder[T, K]) Build() CachedContextKeyFunc[T, K] {
+	fn, _ := builder.BuildWithHandle()
+	return fn
+}
+
+// BuildWithHandle builds the cached function along with a handle to
+// inspect it.
+func (builder CachedFuncBuilder[T]) BuildWithHandle() (CachedContextFunc[T], *FuncHandle[T]) {
+	state := &CachedFuncState[T]{
 		CachedFuncBuilder: builder,
 	}
-	return state.callContext
+	handle := &FuncHandle[T]{state: state}
+	if builder.name != "" {
+		registerStats(builder.name, handle)
+	}
+	if state.refreshesAhead() {
+		state.startRefreshAhead()
+	}
+	if builder.parent != nil {
+		builder.parent.OnCancel(callbackName("close cache", builder.name), handle.Close)
+	}
+	return state.callContext, handle
 }
 
-func (builder CachedKeyFuncBuilder[T, K]) Build() CachedContextKeyFunc[T, K] {
+// callbackName names a task callback about the cache named name, which may
+// be unnamed.
+func callbackName(about, name string) string {
+	if name == "" {
+		return about
+	}
+	return about + " " + name
+}
+
+// BuildWithHandle builds the cached function along with a handle to
+// inspect it.
+func (builder CachedKeyFuncBuilder[T, K]) BuildWithHandle() (CachedContextKeyFunc[T, K], *KeyFuncHandle[T, K]) {
 	state := newCachedContextKeyFuncState(builder)
-	return state.callContext
+	handle := &KeyFuncHandle[T, K]{state: state}
+	if builder.name != "" {
+		registerStats(builder.name, handle)
+	}
+	if builder.snapshotPath != "" {
+		handle.loadSnapshotFile(builder.snapshotPath)
+	}
+	switch {
+	case builder.parent != nil:
+		builder.parent.OnCancel(callbackName("close cache", builder.name), func() {
+			if builder.snapshotPath != "" {
+				handle.saveSnapshotFile(builder.snapshotPath)
+			}
+			handle.Close()
+		})
+	case builder.snapshotPath != "":
+		task.OnProgramExit(callbackName("save cache snapshot", builder.name), func() {
+			handle.saveSnapshotFile(builder.snapshotPath)
+		})
+	}
+	return state.callContext, handle
 }
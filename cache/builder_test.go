@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -62,6 +64,38 @@ func TestWithRetriesZeroBackoff(t *testing.T) {
 	assert.IsType(t, &backoff.ZeroBackOff{}, builder.backoff)
 }
 
+func TestWithRetriesJitterBackoff(t *testing.T) {
+	fn := func(ctx context.Context) (string, error) {
+		return "test", nil
+	}
+
+	builder := NewFunc(fn).WithRetriesFullJitterBackoff(3, time.Millisecond, time.Second)
+	assert.Equal(t, 3, builder.retries)
+	assert.Equal(t, &fullJitterBackOff{base: time.Millisecond, max: time.Second}, builder.backoffFactory())
+
+	keyBuilder := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithRetriesDecorrelatedJitterBackoff(4, time.Millisecond, time.Second)
+	assert.Equal(t, 4, keyBuilder.retries)
+	assert.Equal(t, &decorrelatedJitterBackOff{base: time.Millisecond, max: time.Second}, keyBuilder.backoffFactory())
+}
+
+func TestWithRetryIfAndBudget(t *testing.T) {
+	var calls atomic.Int32
+	permanent := errors.New("permanent")
+	cachedFunc := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		calls.Add(1)
+		return "", permanent
+	}).WithRetriesZeroBackoff(5).
+		WithRetryIf(func(err error) bool { return !errors.Is(err, permanent) }).
+		WithRetryBudget(time.Second).
+		Build()
+
+	_, err := cachedFunc(t.Context(), "a")
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, int32(1), calls.Load(), "permanent errors are not retried")
+}
+
 func TestWithTTL(t *testing.T) {
 	fn := func(ctx context.Context) (string, error) {
 		return "test", nil
@@ -72,6 +106,36 @@ func TestWithTTL(t *testing.T) {
 	assert.Equal(t, ttl, builder.ttl)
 }
 
+func TestWithErrorTTLAndCacheErrorIf(t *testing.T) {
+	fn := func(ctx context.Context) (string, error) {
+		return "test", nil
+	}
+
+	builder := NewFunc(fn).WithErrorTTL(time.Second).WithCacheErrorIf(func(error) bool { return false })
+	assert.Equal(t, time.Second, builder.errorTTL)
+	assert.NotNil(t, builder.cacheErrorIf)
+
+	keyBuilder := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithErrorTTL(2 * time.Second)
+	assert.Equal(t, 2*time.Second, keyBuilder.errorTTL)
+	assert.Nil(t, keyBuilder.cacheErrorIf)
+}
+
+func TestWithStaleWhileRevalidate(t *testing.T) {
+	fn := func(ctx context.Context) (string, error) {
+		return "test", nil
+	}
+
+	builder := NewFunc(fn).WithTTL(time.Minute).WithStaleWhileRevalidate(10 * time.Second)
+	assert.Equal(t, 10*time.Second, builder.staleGrace)
+
+	keyBuilder := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithStaleWhileRevalidate(5 * time.Second)
+	assert.Equal(t, 5*time.Second, keyBuilder.staleGrace)
+}
+
 func TestBuild(t *testing.T) {
 	fn := func(ctx context.Context) (string, error) {
 		return "test", nil
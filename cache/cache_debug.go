@@ -5,11 +5,16 @@ package cache
 import (
 	"fmt"
 	"reflect"
+	"runtime/debug"
 	"slices"
 
 	"github.com/rs/zerolog/log"
 )
 
+func panicWithDebugStack() {
+	panic(string(debug.Stack()))
+}
+
 func logCacheExpiredEntry(key any, result any, err error) {
 	log.Debug().
 		Interface("key", formatResult(key)).
@@ -36,6 +41,13 @@ func logCacheHit(key any, result any, err error) {
 		Msg("cache: hit")
 }
 
+func logCacheStaleHit(key any, result any) {
+	log.Debug().
+		Interface("key", formatResult(key)).
+		Interface("result", formatResult(result)).
+		Msg("cache: stale hit, revalidating")
+}
+
 func logCacheMiss(key any) {
 	log.Debug().
 		Interface("key", formatResult(key)).
@@ -2,6 +2,8 @@
 
 package cache
 
+func panicWithDebugStack() {}
+
 func logCacheExpiredEntry(key any, result any, err error) {}
 
 func logCacheEvicted(maxEntries int, sizeAfter int, evicted cacheEvictedKV) {}
@@ -10,6 +12,8 @@ func logCacheHit(key any, result any, err error) {}
 
 func logCacheMiss(key any) {}
 
+func logCacheStaleHit(key any, result any) {}
+
 func logCacheUsage(size int, maxEntries int) {}
 
 func formatResult(result any) any { return result }
@@ -0,0 +1,382 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"math/bits"
+)
+
+// EvictionPolicy decides which keys a bounded keyed cache drops once it
+// holds more than WithMaxEntries entries.
+//
+// Implementations do not need to be concurrency-safe: the cache serializes
+// every call. Access and Remove may be called with keys the policy does not
+// track, and must ignore them.
+type EvictionPolicy[K comparable] interface {
+	// Add records that key was inserted.
+	Add(key K)
+	// Access records that key was read.
+	Access(key K)
+	// Remove forgets key, which left the cache for another reason.
+	Remove(key K)
+	// Evict picks the next key to drop and forgets it. ok is false when the
+	// policy tracks no keys.
+	Evict() (key K, ok bool)
+}
+
+// EvictionPolicyFactory creates the policy of a cache holding up to
+// capacity entries. NewLRUPolicy, NewLFUPolicy and NewTinyLFUPolicy are
+// EvictionPolicyFactory values once instantiated with the key type.
+type EvictionPolicyFactory[K comparable] func(capacity int) EvictionPolicy[K]
+
+// LRUPolicy evicts the least recently used key.
+type LRUPolicy[K comparable] struct {
+	order *list.List // front is most recent
+	items map[K]*list.Element
+}
+
+func NewLRUPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return &LRUPolicy[K]{
+		order: list.New(),
+		items: make(map[K]*list.Element, capacity),
+	}
+}
+
+func (p *LRUPolicy[K]) Add(key K) {
+	if elem, ok := p.items[key]; ok {
+		p.order.MoveToFront(elem)
+		return
+	}
+	p.items[key] = p.order.PushFront(key)
+}
+
+func (p *LRUPolicy[K]) Access(key K) {
+	if elem, ok := p.items[key]; ok {
+		p.order.MoveToFront(elem)
+	}
+}
+
+func (p *LRUPolicy[K]) Remove(key K) {
+	if elem, ok := p.items[key]; ok {
+		p.order.Remove(elem)
+		delete(p.items, key)
+	}
+}
+
+func (p *LRUPolicy[K]) Evict() (key K, ok bool) {
+	elem := p.order.Back()
+	if elem == nil {
+		return key, false
+	}
+	key = p.order.Remove(elem).(K)
+	delete(p.items, key)
+	return key, true
+}
+
+// LFUPolicy evicts the least frequently used key, breaking ties by recency.
+// It keeps keys in frequency buckets, so every operation is O(1).
+type LFUPolicy[K comparable] struct {
+	buckets *list.List // of *lfuBucket[K], ascending frequency
+	items   map[K]*lfuItem[K]
+}
+
+type lfuBucket[K comparable] struct {
+	freq  uint64
+	items *list.List // of K, front is most recent
+}
+
+type lfuItem[K comparable] struct {
+	bucket *list.Element
+	elem   *list.Element
+}
+
+func NewLFUPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return &LFUPolicy[K]{
+		buckets: list.New(),
+		items:   make(map[K]*lfuItem[K], capacity),
+	}
+}
+
+func (p *LFUPolicy[K]) Add(key K) {
+	if _, ok := p.items[key]; ok {
+		p.Access(key)
+		return
+	}
+	front := p.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket[K]).freq != 1 {
+		front = p.buckets.PushFront(&lfuBucket[K]{freq: 1, items: list.New()})
+	}
+	p.items[key] = &lfuItem[K]{
+		bucket: front,
+		elem:   front.Value.(*lfuBucket[K]).items.PushFront(key),
+	}
+}
+
+func (p *LFUPolicy[K]) Access(key K) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	cur := item.bucket.Value.(*lfuBucket[K])
+	next := item.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket[K]).freq != cur.freq+1 {
+		next = p.buckets.InsertAfter(&lfuBucket[K]{freq: cur.freq + 1, items: list.New()}, item.bucket)
+	}
+	p.unlink(item)
+	item.bucket = next
+	item.elem = next.Value.(*lfuBucket[K]).items.PushFront(key)
+}
+
+func (p *LFUPolicy[K]) Remove(key K) {
+	if item, ok := p.items[key]; ok {
+		p.unlink(item)
+		delete(p.items, key)
+	}
+}
+
+func (p *LFUPolicy[K]) Evict() (key K, ok bool) {
+	front := p.buckets.Front()
+	if front == nil {
+		return key, false
+	}
+	key = front.Value.(*lfuBucket[K]).items.Back().Value.(K)
+	p.Remove(key)
+	return key, true
+}
+
+// unlink removes item from its bucket, dropping the bucket once empty.
+func (p *LFUPolicy[K]) unlink(item *lfuItem[K]) {
+	bucket := item.bucket.Value.(*lfuBucket[K])
+	bucket.items.Remove(item.elem)
+	if bucket.items.Len() == 0 {
+		p.buckets.Remove(item.bucket)
+	}
+}
+
+// TinyLFUPolicy implements W-TinyLFU: new keys enter a small LRU window, and
+// a key leaving the window is only admitted into the main segmented LRU if a
+// count-min sketch estimates it is used more often than the key it would
+// replace. One-off keys from scans therefore never push hot keys out.
+type TinyLFUPolicy[K comparable] struct {
+	sketch countMinSketch
+	hash   func(K) uint64
+
+	window    *list.List // of *tinyLFUItem[K], front is most recent
+	probation *list.List
+	protected *list.List
+	items     map[K]*list.Element
+
+	windowCap    int
+	mainCap      int
+	protectedCap int
+}
+
+type tinyLFUSegment uint8
+
+const (
+	segmentWindow tinyLFUSegment = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyLFUItem[K comparable] struct {
+	key     K
+	hash    uint64
+	segment tinyLFUSegment
+}
+
+func NewTinyLFUPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	seed := maphash.MakeSeed()
+	return newTinyLFUPolicy(capacity, func(key K) uint64 {
+		return maphash.Comparable(seed, key)
+	})
+}
+
+// newTinyLFUPolicy creates a TinyLFUPolicy hashing keys with hash, which
+// tests set to make sketch collisions reproducible.
+func newTinyLFUPolicy[K comparable](capacity int, hash func(K) uint64) *TinyLFUPolicy[K] {
+	capacity = max(capacity, 2)
+	windowCap := max(1, capacity/100)
+	mainCap := capacity - windowCap
+	return &TinyLFUPolicy[K]{
+		sketch:       newCountMinSketch(capacity),
+		hash:         hash,
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		items:        make(map[K]*list.Element, capacity),
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: max(1, mainCap*8/10),
+	}
+}
+
+func (p *TinyLFUPolicy[K]) Add(key K) {
+	if _, ok := p.items[key]; ok {
+		p.Access(key)
+		return
+	}
+	item := &tinyLFUItem[K]{key: key, hash: p.hash(key), segment: segmentWindow}
+	p.sketch.increment(item.hash)
+	p.items[key] = p.window.PushFront(item)
+	// while the cache still has room the window overflows straight into main
+	if p.window.Len() > p.windowCap && p.mainLen() < p.mainCap {
+		p.moveTo(p.window.Back(), segmentProbation)
+	}
+}
+
+func (p *TinyLFUPolicy[K]) Access(key K) {
+	elem, ok := p.items[key]
+	if !ok {
+		return
+	}
+	item := elem.Value.(*tinyLFUItem[K])
+	p.sketch.increment(item.hash)
+	switch item.segment {
+	case segmentWindow:
+		p.window.MoveToFront(elem)
+	case segmentProbation:
+		p.moveTo(elem, segmentProtected)
+		if p.protected.Len() > p.protectedCap {
+			p.moveTo(p.protected.Back(), segmentProbation)
+		}
+	case segmentProtected:
+		p.protected.MoveToFront(elem)
+	}
+}
+
+func (p *TinyLFUPolicy[K]) Remove(key K) {
+	if elem, ok := p.items[key]; ok {
+		p.segmentList(elem.Value.(*tinyLFUItem[K]).segment).Remove(elem)
+		delete(p.items, key)
+	}
+}
+
+func (p *TinyLFUPolicy[K]) Evict() (key K, ok bool) {
+	for p.window.Len() > p.windowCap {
+		candidate := p.window.Back()
+		victim := p.mainVictim()
+		if victim == nil {
+			p.moveTo(candidate, segmentProbation)
+			continue
+		}
+		// admission: the window candidate replaces the main victim only if it
+		// is estimated to be more popular
+		if p.frequency(candidate) > p.frequency(victim) {
+			p.moveTo(candidate, segmentProbation)
+			return p.drop(victim), true
+		}
+		return p.drop(candidate), true
+	}
+	if victim := p.mainVictim(); victim != nil {
+		return p.drop(victim), true
+	}
+	if candidate := p.window.Back(); candidate != nil {
+		return p.drop(candidate), true
+	}
+	return key, false
+}
+
+func (p *TinyLFUPolicy[K]) mainLen() int {
+	return p.probation.Len() + p.protected.Len()
+}
+
+func (p *TinyLFUPolicy[K]) mainVictim() *list.Element {
+	if victim := p.probation.Back(); victim != nil {
+		return victim
+	}
+	return p.protected.Back()
+}
+
+func (p *TinyLFUPolicy[K]) frequency(elem *list.Element) uint8 {
+	return p.sketch.estimate(elem.Value.(*tinyLFUItem[K]).hash)
+}
+
+func (p *TinyLFUPolicy[K]) segmentList(segment tinyLFUSegment) *list.List {
+	switch segment {
+	case segmentWindow:
+		return p.window
+	case segmentProbation:
+		return p.probation
+	default:
+		return p.protected
+	}
+}
+
+func (p *TinyLFUPolicy[K]) moveTo(elem *list.Element, segment tinyLFUSegment) {
+	item := elem.Value.(*tinyLFUItem[K])
+	p.segmentList(item.segment).Remove(elem)
+	item.segment = segment
+	p.items[item.key] = p.segmentList(segment).PushFront(item)
+}
+
+func (p *TinyLFUPolicy[K]) drop(elem *list.Element) K {
+	item := elem.Value.(*tinyLFUItem[K])
+	p.segmentList(item.segment).Remove(elem)
+	delete(p.items, item.key)
+	return item.key
+}
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+)
+
+// countMinSketch estimates key frequencies with 4-bit saturating counters.
+// All counters are halved once the number of increments reaches ten times
+// the capacity, so the estimates favor recent popularity.
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	resetAfter int
+}
+
+func newCountMinSketch(capacity int) countMinSketch {
+	width := uint64(1) << bits.Len64(uint64(4*max(capacity, 16)-1))
+	var sketch countMinSketch
+	for i := range sketch.rows {
+		sketch.rows[i] = make([]uint8, width)
+	}
+	sketch.mask = width - 1
+	sketch.resetAfter = 10 * max(capacity, 16)
+	return sketch
+}
+
+func (s *countMinSketch) index(hash uint64, row int) uint64 {
+	// derive one independent-enough index per row from a single hash
+	h := hash + uint64(row)*0x9e3779b97f4a7c15
+	h ^= h >> 32
+	h *= 0xd6e8feb86659fd93
+	h ^= h >> 32
+	return h & s.mask
+}
+
+func (s *countMinSketch) increment(hash uint64) {
+	for row := range s.rows {
+		if c := &s.rows[row][s.index(hash, row)]; *c < sketchMaxCounter {
+			*c++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAfter {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(hash uint64) uint8 {
+	est := uint8(sketchMaxCounter)
+	for row := range s.rows {
+		est = min(est, s.rows[row][s.index(hash, row)])
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	for row := range s.rows {
+		for i := range s.rows[row] {
+			s.rows[row][i] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,349 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func evictAll[K comparable](policy EvictionPolicy[K]) []K {
+	var keys []K
+	for {
+		key, ok := policy.Evict()
+		if !ok {
+			return keys
+		}
+		keys = append(keys, key)
+	}
+}
+
+func TestLRUPolicy(t *testing.T) {
+	policy := NewLRUPolicy[string](4)
+	policy.Add("a")
+	policy.Add("b")
+	policy.Add("c")
+	policy.Access("a")
+	policy.Access("missing")
+	policy.Remove("b")
+	policy.Remove("missing")
+
+	assert.Equal(t, []string{"c", "a"}, evictAll(policy))
+}
+
+func TestLFUPolicy(t *testing.T) {
+	policy := NewLFUPolicy[string](4)
+	policy.Add("a")
+	policy.Add("b")
+	policy.Add("c")
+	policy.Add("d")
+	for range 3 {
+		policy.Access("a")
+	}
+	policy.Access("c")
+	policy.Access("missing")
+	policy.Remove("d")
+
+	// b is least frequent, c and a follow by frequency
+	assert.Equal(t, []string{"b", "c", "a"}, evictAll(policy))
+}
+
+func TestLFUPolicyTiesBrokenByRecency(t *testing.T) {
+	policy := NewLFUPolicy[int](4)
+	policy.Add(1)
+	policy.Add(2)
+	policy.Access(1)
+	policy.Access(2)
+
+	key, ok := policy.Evict()
+	require.True(t, ok)
+	assert.Equal(t, 1, key)
+}
+
+func TestTinyLFUPolicyRejectsOneOffKeys(t *testing.T) {
+	const capacity = 100
+	// a fixed hash keeps sketch collisions, and so admissions, the same on
+	// every run
+	policy := newTinyLFUPolicy(capacity, func(key int) uint64 {
+		return uint64(key) * 0x9e3779b97f4a7c15
+	})
+	tracked := make(map[int]struct{})
+	add := func(key int) {
+		policy.Add(key)
+		tracked[key] = struct{}{}
+		for len(tracked) > capacity {
+			victim, ok := policy.Evict()
+			require.True(t, ok)
+			delete(tracked, victim)
+		}
+	}
+
+	// a hot set, accessed repeatedly
+	for key := range capacity {
+		add(key)
+	}
+	for range 5 {
+		for key := range capacity {
+			policy.Access(key)
+		}
+	}
+
+	// a scan of keys that are never seen again
+	for key := 1000; key < 1000+10*capacity; key++ {
+		add(key)
+	}
+
+	hot := 0
+	for key := range capacity {
+		if _, ok := tracked[key]; ok {
+			hot++
+		}
+	}
+	assert.GreaterOrEqual(t, hot, capacity*9/10, "scan should not push the hot set out")
+}
+
+func TestTinyLFUPolicyEvictsEverything(t *testing.T) {
+	policy := NewTinyLFUPolicy[int](10)
+	for key := range 20 {
+		policy.Add(key)
+	}
+	policy.Access(3)
+	policy.Remove(5)
+
+	evicted := evictAll(policy)
+	assert.Len(t, evicted, 19)
+	assert.NotContains(t, evicted, 5)
+}
+
+func TestCountMinSketch(t *testing.T) {
+	sketch := newCountMinSketch(64)
+	for range 20 {
+		sketch.increment(1)
+	}
+	sketch.increment(2)
+
+	assert.Equal(t, uint8(sketchMaxCounter), sketch.estimate(1), "counters saturate")
+	assert.GreaterOrEqual(t, sketch.estimate(2), uint8(1))
+
+	sketch.reset()
+	assert.Equal(t, uint8(sketchMaxCounter/2), sketch.estimate(1), "reset halves counters")
+}
+
+func TestCachedContextKeyFuncState_EvictionPolicy(t *testing.T) {
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	}).WithMaxEntries(3).WithEvictionPolicy(NewLFUPolicy[int]).BuildWithHandle()
+	ctx := t.Context()
+
+	for key := range 3 {
+		_, _ = cachedFunc(ctx, key)
+	}
+	// make 0 and 2 frequent, then add a fourth key
+	for range 3 {
+		_, _ = cachedFunc(ctx, 0)
+		_, _ = cachedFunc(ctx, 2)
+	}
+	_, _ = cachedFunc(ctx, 3)
+
+	handle.state.Cleanup()
+	assert.Equal(t, 3, handle.state.entries.Size())
+	_, _, ok := handle.Peek(1)
+	assert.False(t, ok, "least frequently used key should be evicted")
+	for _, key := range []int{0, 2, 3} {
+		_, _, ok := handle.Peek(key)
+		assert.Truef(t, ok, "key %d should survive", key)
+	}
+	assert.Equal(t, uint64(1), handle.Stats().Evictions[EvictReasonCapacity])
+
+	// invalidated keys are forgotten by the policy
+	handle.Invalidate(0)
+	_, _ = cachedFunc(ctx, 4)
+	_, _ = cachedFunc(ctx, 5)
+	handle.state.Cleanup()
+	assert.Equal(t, 3, handle.state.entries.Size())
+}
+
+func TestWithEvictionPolicy(t *testing.T) {
+	builder := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithEvictionPolicy(NewTinyLFUPolicy[string])
+	assert.NotNil(t, builder.evictionPolicy)
+
+	// without max entries the policy is never created
+	_, handle := builder.BuildWithHandle()
+	assert.Nil(t, handle.state.policy)
+
+	_, handle = builder.WithMaxEntries(10).BuildWithHandle()
+	assert.IsType(t, &TinyLFUPolicy[string]{}, handle.state.policy)
+}
+
+func TestCachedContextKeyFuncState_MaxCost(t *testing.T) {
+	errBoom := errors.New("boom")
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		if key == "err" {
+			return "", errBoom
+		}
+		return strings.Repeat("x", len(key)), nil
+	}).WithMaxCost(10, nil).WithEvictionPolicy(NewLRUPolicy[string]).BuildWithHandle()
+	ctx := t.Context()
+
+	_, _ = cachedFunc(ctx, "aaaa")
+	_, _ = cachedFunc(ctx, "bbbb")
+	_, _ = cachedFunc(ctx, "err")
+	assert.Equal(t, int64(8), handle.Cost(), "cached errors cost nothing")
+
+	_, _ = cachedFunc(ctx, "aaaa") // make "bbbb" the least recently used
+	_, _ = cachedFunc(ctx, "cccc") // over budget, also triggers the janitor
+
+	handle.state.Cleanup()
+	assert.Equal(t, int64(8), handle.Cost())
+	_, _, ok := handle.Peek("bbbb")
+	assert.False(t, ok, "least recently used key should be evicted")
+	assert.Equal(t, uint64(1), handle.Stats().Evictions[EvictReasonCapacity])
+
+	// replacing a value adjusts the cost, invalidating releases it
+	handle.Set("aaaa", "xx")
+	assert.Equal(t, int64(6), handle.Cost())
+	handle.Invalidate("cccc")
+	assert.Equal(t, int64(2), handle.Cost())
+	assert.Equal(t, int64(2), handle.Stats().Cost)
+}
+
+func TestCachedContextKeyFuncState_MaxCostWithoutPolicy(t *testing.T) {
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key int) ([]byte, error) {
+		return make([]byte, key), nil
+	}).WithMaxCost(100, nil).BuildWithHandle()
+	ctx := t.Context()
+
+	for _, key := range []int{40, 30, 20, 50} {
+		_, _ = cachedFunc(ctx, key)
+	}
+
+	handle.state.Cleanup()
+	assert.Equal(t, int64(100), handle.Cost(), "oldest entries are evicted until within budget")
+	assert.ElementsMatch(t, []int{30, 20, 50}, slices.Collect(handle.Keys()))
+}
+
+func TestWithMaxCost(t *testing.T) {
+	builder := NewKeyFunc(func(ctx context.Context, key string) (int, error) {
+		return 0, nil
+	}).WithMaxCost(5, nil)
+	assert.Equal(t, int64(5), builder.maxCost)
+	assert.Equal(t, int64(1), builder.costFn("key", 42), "default cost of non-byte values is 1")
+
+	builder = builder.WithMaxCost(5, func(key string, value int) int64 { return int64(value) })
+	assert.Equal(t, int64(42), builder.costFn("key", 42))
+}
+
+type evictedValue struct {
+	key    string
+	value  string
+	reason EvictReason
+}
+
+type evictRecorder struct {
+	mu     sync.Mutex
+	values []evictedValue
+}
+
+func (r *evictRecorder) onEvict(key string, value string, reason EvictReason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values = append(r.values, evictedValue{key, value, reason})
+}
+
+func (r *evictRecorder) take() []evictedValue {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := r.values
+	r.values = nil
+	return values
+}
+
+func TestWithOnEvict(t *testing.T) {
+	var recorder evictRecorder
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		if key == "err" {
+			return "", errors.New("boom")
+		}
+		return "v-" + key, nil
+	}).WithOnEvict(recorder.onEvict).WithTTL(time.Hour).BuildWithHandle()
+	ctx := t.Context()
+
+	_, _ = cachedFunc(ctx, "a")
+	_, _ = cachedFunc(ctx, "b")
+	_, _ = cachedFunc(ctx, "err")
+
+	handle.Set("a", "new")
+	_, _ = handle.Refresh(ctx, "b")
+	handle.Invalidate("a")
+	handle.Invalidate("err")
+	handle.Invalidate("missing")
+
+	assert.Equal(t, []evictedValue{
+		{"a", "v-a", EvictReasonReplaced},
+		{"b", "v-b", EvictReasonReplaced},
+		{"a", "new", EvictReasonInvalidated},
+	}, recorder.take(), "cached errors are not reported")
+	assert.Equal(t, uint64(2), handle.Stats().Evictions[EvictReasonReplaced])
+}
+
+func TestWithOnEvictCapacity(t *testing.T) {
+	var recorder evictRecorder
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return "v-" + key, nil
+	}).WithMaxEntries(2).WithEvictionPolicy(NewLRUPolicy[string]).WithOnEvict(recorder.onEvict).BuildWithHandle()
+	ctx := t.Context()
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = cachedFunc(ctx, key)
+	}
+	handle.state.Cleanup()
+
+	assert.Equal(t, []evictedValue{{"a", "v-a", EvictReasonCapacity}}, recorder.take())
+}
+
+func TestWithOnEvictExpired(t *testing.T) {
+	var recorder evictRecorder
+	var calls atomic.Int32
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return fmt.Sprintf("v%d-%s", calls.Add(1), key), nil
+	}).WithTTL(20 * time.Millisecond).WithOnEvict(recorder.onEvict).BuildWithHandle()
+	ctx := t.Context()
+
+	_, _ = cachedFunc(ctx, "a")
+	_, _ = cachedFunc(ctx, "b")
+	time.Sleep(30 * time.Millisecond)
+
+	// recomputing an expired entry reports the old value, and the janitor
+	// drops expired entries nobody asked for again
+	_, _ = cachedFunc(ctx, "a")
+	handle.state.Cleanup()
+	assert.ElementsMatch(t, []evictedValue{
+		{"a", "v1-a", EvictReasonExpired},
+		{"b", "v2-b", EvictReasonExpired},
+	}, recorder.take())
+	assert.Equal(t, []string{"a"}, slices.Collect(handle.Keys()))
+}
+
+func TestWithOnEvictKeepsStaleServableEntries(t *testing.T) {
+	var recorder evictRecorder
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return "v-" + key, nil
+	}).WithTTL(10 * time.Millisecond).WithStaleWhileRevalidate(time.Hour).WithOnEvict(recorder.onEvict).BuildWithHandle()
+
+	_, _ = cachedFunc(t.Context(), "a")
+	time.Sleep(20 * time.Millisecond)
+
+	handle.state.Cleanup()
+	assert.Empty(t, recorder.take())
+	assert.Equal(t, 1, handle.Stats().Size)
+}
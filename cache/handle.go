@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"context"
+	"iter"
+)
+
+// FuncHandle gives access to a cached function built with
+// CachedFuncBuilder.BuildWithHandle.
+type FuncHandle[T any] struct {
+	state *CachedFuncState[T]
+}
+
+// KeyFuncHandle gives access to a cached function built with
+// CachedKeyFuncBuilder.BuildWithHandle.
+type KeyFuncHandle[T any, K comparable] struct {
+	state *CachedContextKeyFuncState[T, K]
+}
+
+var (
+	_ StatsProvider = (*FuncHandle[any])(nil)
+	_ StatsProvider = (*KeyFuncHandle[any, string])(nil)
+)
+
+// Stats returns a snapshot of the cache's counters.
+func (h *FuncHandle[T]) Stats() Stats {
+	return h.state.Stats()
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (h *KeyFuncHandle[T, K]) Stats() Stats {
+	return h.state.Stats()
+}
+
+// Invalidate drops the cached value, so the next call computes it again.
+// A computation already in flight still delivers its result to its caller
+// but is not cached.
+func (h *FuncHandle[T]) Invalidate() {
+	h.state.invalidate()
+}
+
+// Refresh computes the value now, regardless of whether the cached one has
+// expired, and caches the result under the usual rules.
+func (h *FuncHandle[T]) Refresh(ctx context.Context) (T, error) {
+	state := h.state
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	gen := state.currentGeneration()
+	result, err := state.execute(ctx)
+	if state.shouldCache(ctx, err) {
+		state.setResult(gen, result, err)
+	}
+	return result, err
+}
+
+// Peek returns the cached value without computing it. ok is false when
+// nothing is cached or the cached value has expired.
+func (h *FuncHandle[T]) Peek() (result T, err error, ok bool) {
+	cached := h.state.cached.Load()
+	if h.state.cachedExpired(cached) {
+		return result, nil, false
+	}
+	return cached.result, cached.err, true
+}
+
+// Set primes the cache with value, as if it had just been computed. A
+// computation already in flight still delivers its result to its caller but
+// does not overwrite value.
+func (h *FuncHandle[T]) Set(value T) {
+	h.state.set(value)
+}
+
+// Close unregisters the cache from RegisteredStats, stops the refreshes
+// scheduled by WithRefreshAhead and drops the cached value. The cached
+// function keeps working after Close, without refreshing ahead. Close is
+// idempotent.
+func (h *FuncHandle[T]) Close() {
+	h.state.close(h)
+}
+
+// Invalidate drops the entry for key, so the next call for it computes it
+// again, and reports its value to OnEvict. A computation already in flight
+// still delivers its result to its waiters but is not cached.
+func (h *KeyFuncHandle[T, K]) Invalidate(key K) {
+	h.state.invalidate(key)
+}
+
+// InvalidateAll drops every entry.
+func (h *KeyFuncHandle[T, K]) InvalidateAll() {
+	h.state.invalidateAll()
+}
+
+// Cost returns the total cost of the cached values, as computed by the
+// cost function given to WithMaxCost. It is 0 without WithMaxCost.
+func (h *KeyFuncHandle[T, K]) Cost() int64 {
+	return h.state.totalCost.Load()
+}
+
+// Refresh computes the value for key now, regardless of whether the cached
+// one has expired, and caches the result under the usual rules. A refresh
+// joins a computation for key that is already in flight rather than
+// starting a second one.
+func (h *KeyFuncHandle[T, K]) Refresh(ctx context.Context, key K) (T, error) {
+	state := h.state
+	entry, loaded := state.entries.LoadOrCompute(key, newCacheEntry[T])
+
+	entry.refreshMu.Lock()
+	call := entry.inflight
+	if call == nil {
+		call = state.startCall(ctx, key, entry, false)
+	}
+	call.waiters++
+	entry.refreshMu.Unlock()
+
+	result, err := state.waitCall(ctx, entry, call)
+
+	state.trackEntry(key, entry, loaded)
+	return result, err
+}
+
+// Peek returns the cached value for key without computing it. ok is false
+// when nothing is cached for key or the cached value has expired.
+func (h *KeyFuncHandle[T, K]) Peek(key K) (result T, err error, ok bool) {
+	entry, loaded := h.state.entries.Load(key)
+	if !loaded {
+		return result, nil, false
+	}
+	cached := entry.cached.Load()
+	if h.state.checkExpired(cached) {
+		return result, nil, false
+	}
+	return cached.result, cached.err, true
+}
+
+// Set primes the cache for key with value, as if it had just been computed.
+// A computation for key already in flight still delivers its result to its
+// waiters but does not overwrite value.
+func (h *KeyFuncHandle[T, K]) Set(key K, value T) {
+	state := h.state
+	entry, loaded := state.entries.LoadOrCompute(key, newCacheEntry[T])
+
+	entry.refreshMu.Lock()
+	entry.inflight = nil
+	replaced, hasReplaced := state.storeValue(key, entry, newCachedValue(value, nil, state.ttl, state.now()))
+	entry.refreshMu.Unlock()
+
+	if hasReplaced {
+		state.notifyEvict(replaced.key, replaced.value, replaced.reason)
+	}
+	state.trackEntry(key, entry, loaded)
+}
+
+// Close unregisters the cache from Janitor and from RegisteredStats, and
+// drops every entry, reporting their values to OnEvict. The cached function
+// keeps working after Close, but its cache is no longer trimmed nor swept.
+// Close is idempotent.
+func (h *KeyFuncHandle[T, K]) Close() {
+	h.state.close(h)
+}
+
+// Keys iterates over the keys that currently hold a cached value, expired
+// or not. Keys whose first computation is still in flight are skipped.
+func (h *KeyFuncHandle[T, K]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key, entry := range h.state.entries.Range {
+			if entry.cached.Load() == nil {
+				continue
+			}
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
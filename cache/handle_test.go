@@ -0,0 +1,340 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/task"
+)
+
+func TestFuncHandle_InvalidateRefreshPeekSet(t *testing.T) {
+	var calls atomic.Int32
+	cachedFunc, handle := NewFunc(func(ctx context.Context) (int32, error) {
+		return calls.Add(1), nil
+	}).BuildWithHandle()
+	ctx := t.Context()
+
+	_, _, ok := handle.Peek()
+	assert.False(t, ok, "peek must not trigger a load")
+	assert.Zero(t, calls.Load())
+
+	result, err := cachedFunc(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), result)
+
+	result, err, ok = handle.Peek()
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), result)
+
+	result, err = handle.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+	result, _ = cachedFunc(ctx)
+	assert.Equal(t, int32(2), result)
+
+	handle.Invalidate()
+	_, _, ok = handle.Peek()
+	assert.False(t, ok)
+	result, _ = cachedFunc(ctx)
+	assert.Equal(t, int32(3), result)
+	assert.Equal(t, uint64(1), handle.Stats().Evictions[EvictReasonInvalidated])
+
+	handle.Set(100)
+	result, _ = cachedFunc(ctx)
+	assert.Equal(t, int32(100), result)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestFuncHandle_InvalidateDuringComputation(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cachedFunc, handle := NewFunc(func(ctx context.Context) (int32, error) {
+		n := calls.Add(1)
+		if n == 1 {
+			close(started)
+			<-release
+		}
+		return n, nil
+	}).BuildWithHandle()
+	ctx := t.Context()
+
+	done := make(chan int32)
+	go func() {
+		result, _ := cachedFunc(ctx)
+		done <- result
+	}()
+	<-started
+	handle.Invalidate()
+	close(release)
+	assert.Equal(t, int32(1), <-done, "the caller still gets its result")
+
+	_, _, ok := handle.Peek()
+	assert.False(t, ok, "a value computed before Invalidate is not cached")
+	result, err := cachedFunc(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+
+	started = make(chan struct{})
+	release = make(chan struct{})
+	calls.Store(0)
+	handle.Invalidate()
+	go func() {
+		result, _ := handle.Refresh(ctx)
+		done <- result
+	}()
+	<-started
+	handle.Set(100)
+	close(release)
+	<-done
+	result, _, _ = handle.Peek()
+	assert.Equal(t, int32(100), result, "a refresh started before Set does not overwrite it")
+}
+
+func TestKeyFuncHandle_InvalidateAndInvalidateAll(t *testing.T) {
+	var calls atomic.Int32
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		calls.Add(1)
+		return key, nil
+	}).BuildWithHandle()
+	ctx := t.Context()
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = cachedFunc(ctx, key)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+
+	handle.Invalidate("a")
+	handle.Invalidate("missing")
+	_, _, ok := handle.Peek("a")
+	assert.False(t, ok)
+	_, _, ok = handle.Peek("b")
+	assert.True(t, ok)
+
+	_, _ = cachedFunc(ctx, "a")
+	assert.Equal(t, int32(4), calls.Load())
+
+	handle.InvalidateAll()
+	assert.Empty(t, slices.Collect(handle.Keys()))
+	assert.Zero(t, handle.Stats().Size)
+	assert.Equal(t, uint64(4), handle.Stats().Evictions[EvictReasonInvalidated])
+
+	_, _ = cachedFunc(ctx, "b")
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+func TestKeyFuncHandle_RefreshPeekSetKeys(t *testing.T) {
+	var calls atomic.Int32
+	testErr := errors.New("test error")
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key int) (int, error) {
+		n := int(calls.Add(1))
+		if key < 0 {
+			return 0, testErr
+		}
+		return key*1000 + n, nil
+	}).WithTTL(time.Hour).BuildWithHandle()
+	ctx := t.Context()
+
+	_, _, ok := handle.Peek(1)
+	assert.False(t, ok)
+	assert.Zero(t, calls.Load(), "peek must not trigger a load")
+
+	result, err := handle.Refresh(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1001, result)
+
+	result, err = handle.Refresh(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1002, result, "refresh must recompute a valid entry")
+
+	result, err = cachedFunc(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1002, result)
+
+	_, err = handle.Refresh(ctx, -1)
+	assert.ErrorIs(t, err, testErr)
+	_, err, ok = handle.Peek(-1)
+	assert.True(t, ok)
+	assert.ErrorIs(t, err, testErr)
+
+	handle.Set(2, 42)
+	result, err = cachedFunc(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 42, result)
+	assert.Equal(t, int32(3), calls.Load())
+
+	keys := slices.Collect(handle.Keys())
+	slices.Sort(keys)
+	assert.Equal(t, []int{-1, 1, 2}, keys)
+}
+
+func TestKeyFuncHandle_SetWinsOverInFlightLoad(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key int) (string, error) {
+		close(started)
+		<-release
+		return "loaded", nil
+	}).BuildWithHandle()
+
+	done := make(chan string, 1)
+	go func() {
+		result, _ := cachedFunc(t.Context(), 1)
+		done <- result
+	}()
+	<-started
+
+	handle.Set(1, "primed")
+	close(release)
+
+	assert.Equal(t, "loaded", <-done, "waiters of the in-flight load still get its result")
+	result, _, ok := handle.Peek(1)
+	assert.True(t, ok)
+	assert.Equal(t, "primed", result)
+}
+
+func TestKeyFuncHandle_ConcurrentWithCallContext(t *testing.T) {
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	}).WithMaxEntries(16).BuildWithHandle()
+	ctx := t.Context()
+
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Go(func() {
+			for i := range 500 {
+				key := (worker + i) % 32
+				switch i % 6 {
+				case 0:
+					handle.Invalidate(key)
+				case 1:
+					handle.Set(key, key)
+				case 2:
+					_, _ = handle.Refresh(ctx, key)
+				case 3:
+					_, _, _ = handle.Peek(key)
+				case 4:
+					for range handle.Keys() {
+					}
+				default:
+					result, err := cachedFunc(ctx, key)
+					assert.NoError(t, err)
+					assert.Equal(t, key, result)
+				}
+			}
+		})
+	}
+	wg.Go(func() {
+		for range 50 {
+			handle.InvalidateAll()
+			time.Sleep(time.Millisecond)
+		}
+	})
+	wg.Wait()
+}
+
+func TestFuncHandle_Close(t *testing.T) {
+	var calls atomic.Int32
+	_, handle := NewFunc(func(ctx context.Context) (int32, error) {
+		return calls.Add(1), nil
+	}).WithName(t.Name()).WithTTL(20 * time.Millisecond).WithRefreshAhead(0.5).BuildWithHandle()
+
+	require.Eventually(t, func() bool { return calls.Load() >= 2 }, time.Second, 5*time.Millisecond)
+	require.Contains(t, RegisteredStats(), t.Name())
+
+	handle.Close()
+	handle.Close()
+	assert.NotContains(t, RegisteredStats(), t.Name())
+	assert.Error(t, handle.state.refreshTask.Context().Err(), "refresh-ahead should be stopped")
+
+	// let a refresh that was already running return
+	time.Sleep(20 * time.Millisecond)
+	stoppedAt := calls.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stoppedAt, calls.Load(), "no refresh after Close")
+}
+
+func TestFuncHandle_WithTask(t *testing.T) {
+	parent := task.GetTestTask(t).Subtask("cache", true)
+	cachedFunc, handle := NewFunc(func(ctx context.Context) (int, error) {
+		return 1, nil
+	}).WithName(t.Name()).WithTask(parent).BuildWithHandle()
+	_, _ = cachedFunc(t.Context())
+	require.Contains(t, RegisteredStats(), t.Name())
+
+	parent.FinishAndWait(nil)
+	assert.NotContains(t, RegisteredStats(), t.Name())
+	_, _, ok := handle.Peek()
+	assert.False(t, ok, "the cached value should be dropped")
+
+	// still usable after being closed
+	result, err := cachedFunc(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, result)
+}
+
+func TestWithTask_CallbackName(t *testing.T) {
+	parent := task.GetTestTask(t).Subtask("cache", true)
+	NewFunc(func(ctx context.Context) (int, error) { return 1, nil }).WithTask(parent).Build()
+	NewKeyFunc(func(ctx context.Context, key string) (int, error) { return 1, nil }).WithName(t.Name()).WithTask(parent).Build()
+	NewMap[string, int]().WithTask(parent).Build()
+
+	assert.ElementsMatch(t, []string{"close cache", "close cache " + t.Name(), "close cache map"}, parent.Tree().OnCancel)
+	parent.FinishAndWait(nil)
+}
+
+func TestKeyFuncHandle_Close(t *testing.T) {
+	var evicted []string
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithName(t.Name()).WithMaxEntries(10).WithOnEvict(func(key string, value string, reason EvictReason) {
+		evicted = append(evicted, key+":"+reason.String())
+	}).BuildWithHandle()
+	ctx := t.Context()
+
+	_, _ = cachedFunc(ctx, "a")
+	require.Contains(t, RegisteredStats(), t.Name())
+
+	handle.Close()
+	handle.Close()
+	assert.Equal(t, []string{"a:invalidated"}, evicted)
+	assert.NotContains(t, RegisteredStats(), t.Name())
+	Janitor.mu.RLock()
+	assert.NotContains(t, Janitor.states, handle.state.janitorIdx)
+	Janitor.mu.RUnlock()
+
+	// still usable, just no longer trimmed
+	result, err := cachedFunc(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", result)
+}
+
+func TestWithTask(t *testing.T) {
+	parent := task.GetTestTask(t).Subtask("cache", true)
+	closed := make(chan struct{})
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithMaxEntries(10).WithOnEvict(func(key string, value string, reason EvictReason) {
+		close(closed)
+	}).WithTask(parent).BuildWithHandle()
+
+	_, _ = cachedFunc(t.Context(), "a")
+	parent.Finish(nil)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("cache not closed when its task finished")
+	}
+	Janitor.mu.RLock()
+	assert.NotContains(t, Janitor.states, handle.state.janitorIdx)
+	Janitor.mu.RUnlock()
+}
@@ -2,8 +2,11 @@ package cache
 
 import (
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/yusing/goutils/mockable"
 )
 
 var Janitor = newStatesJanitor()
@@ -19,41 +22,98 @@ type state struct {
 	cleanupInterval time.Duration
 	lastCleanup     time.Time
 	pendingCleanup  atomic.Bool
+	removed         atomic.Bool
+
+	// clock is set for states with a clock other than the real one, which
+	// are cleaned up by their own timer instead of the janitor's ticker.
+	clock   mockable.Clock
+	timerMu sync.Mutex
+	timer   mockable.Timer
 }
 
-const maxStatesPerJanitor = 32
+// janitorSignalBuffer is the number of triggered cleanups that can be queued
+// before TriggerCleanup starts dropping them. A dropped trigger is picked up
+// by the next background cleanup.
+const janitorSignalBuffer = 32
+
+// janitorTick is how often the janitor checks the states using the real
+// clock for a cleanup.
+const janitorTick = time.Second
+
+// clocked is implemented by the states of cached functions, whose cleanup
+// interval is measured with the clock set by WithClock. States with a clock
+// other than the real one are cleaned up every cleanup interval of that
+// clock, so advancing a mockable.FakeClock drives their cleanups.
+type clocked interface {
+	clockOrReal() mockable.Clock
+}
 
 type statesJanitor struct {
-	states    [maxStatesPerJanitor]*state
+	mu        sync.RWMutex
+	states    map[int]*state
+	nextIdx   int
 	numStates atomic.Int32
 	signal    chan *state
 }
 
 func newStatesJanitor() *statesJanitor {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 	go j.runLoop()
 	return j
 }
 
-// Add adds a new state to the janitor. Once the state is added,
-// it cannot be removed. The cleanupInterval is the minimum time
-// between cleanups for this state.
+// Add adds a new state to the janitor and returns its index, to be passed to
+// TriggerCleanup and Remove. The cleanupInterval is the minimum time between
+// cleanups for this state.
 func (j *statesJanitor) Add(s State, cleanupInterval time.Duration) int {
-	idx := int(j.numStates.Add(1)) - 1
-	if idx >= len(j.states) {
-		panic(fmt.Sprintf("too many states: %d", idx))
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.states == nil {
+		j.states = make(map[int]*state)
+	}
+	idx := j.nextIdx
+	j.nextIdx++
+	state := &state{State: s, cleanupInterval: cleanupInterval}
+	if s, ok := s.(clocked); ok {
+		if clock := s.clockOrReal(); clock != mockable.RealClock {
+			state.clock = clock
+			j.scheduleCleanup(state)
+		}
 	}
-	j.states[idx] = &state{State: s, cleanupInterval: cleanupInterval}
+	j.states[idx] = state
+	j.numStates.Add(1)
 	return idx
 }
 
+// Remove removes the state at idx, which is no longer cleaned up once
+// Remove returns, except by a cleanup already running. Removing a state
+// twice is a no-op.
+func (j *statesJanitor) Remove(idx int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.checkIndex(idx)
+	if s, ok := j.states[idx]; ok {
+		s.removed.Store(true)
+		s.stopTimer()
+		delete(j.states, idx)
+		j.numStates.Add(-1)
+	}
+}
+
+// TriggerCleanup requests a cleanup of the state at idx. Triggering a
+// removed state is a no-op.
 func (j *statesJanitor) TriggerCleanup(idx int) {
-	if idx < 0 || idx >= len(j.states) {
-		panic(fmt.Sprintf("invalid state index: %d", idx))
+	j.mu.RLock()
+	j.checkIndex(idx)
+	state, ok := j.states[idx]
+	j.mu.RUnlock()
+	if !ok {
+		return
 	}
-	state := j.states[idx]
 	if !state.pendingCleanup.CompareAndSwap(false, true) {
 		// already triggered
 		return
@@ -65,25 +125,78 @@ func (j *statesJanitor) TriggerCleanup(idx int) {
 	}
 }
 
+// checkIndex panics if idx was never returned by Add.
+// The caller must hold j.mu.
+func (j *statesJanitor) checkIndex(idx int) {
+	if idx < 0 || idx >= j.nextIdx {
+		panic(fmt.Sprintf("invalid state index: %d", idx))
+	}
+}
+
 func (j *statesJanitor) CleanupAll() {
-	states := j.states[:j.numStates.Load()]
-	for _, s := range states {
-		if !s.pendingCleanup.CompareAndSwap(false, true) {
-			// already triggered, will be handled in case s := <-j.signal below
-			continue
+	j.cleanupAll(true)
+}
+
+// cleanupAll cleans up every state, leaving out the states with their own
+// clock unless withClocked is set.
+func (j *statesJanitor) cleanupAll(withClocked bool) {
+	j.mu.RLock()
+	states := make([]*state, 0, len(j.states))
+	for _, s := range j.states {
+		if withClocked || s.clock == nil {
+			states = append(states, s)
 		}
-		j.cleanupTriggered(s)
+	}
+	j.mu.RUnlock()
+
+	for _, s := range states {
+		j.tryCleanup(s)
+	}
+}
+
+// tryCleanup cleans up s unless a triggered cleanup is already pending.
+func (j *statesJanitor) tryCleanup(s *state) {
+	if !s.pendingCleanup.CompareAndSwap(false, true) {
+		// already triggered, will be handled in case s := <-j.signal below
+		return
+	}
+	j.cleanupTriggered(s)
+}
+
+// scheduleCleanup arms the timer of a state with its own clock to clean it
+// up after one cleanup interval, and again after each cleanup, until the
+// state is removed.
+func (j *statesJanitor) scheduleCleanup(s *state) {
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+	if s.removed.Load() {
+		return
+	}
+	s.timer = s.clock.AfterFunc(max(s.cleanupInterval, janitorTick), func() {
+		j.tryCleanup(s)
+		j.scheduleCleanup(s)
+	})
+}
+
+func (s *state) stopTimer() {
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
 	}
 }
 
 func (j *statesJanitor) cleanup(s *state) {
-	now := time.Now()
-	if now.Sub(s.lastCleanup) < s.cleanupInterval {
+	if s.removed.Load() {
+		return
+	}
+	clock := mockable.ClockOrReal(s.clock)
+	if clock.Since(s.lastCleanup) < s.cleanupInterval {
 		// skip cleanup if it's too soon, must've been triggered recently
 		return
 	}
 	s.Cleanup()
-	s.lastCleanup = time.Now()
+	s.lastCleanup = clock.Now()
 }
 
 func (j *statesJanitor) cleanupTriggered(s *state) {
@@ -92,11 +205,11 @@ func (j *statesJanitor) cleanupTriggered(s *state) {
 }
 
 func (j *statesJanitor) runLoop() {
-	ticker := time.NewTicker(time.Second)
+	ticker := time.NewTicker(janitorTick)
 	for {
 		select {
 		case <-ticker.C: // background cleanup
-			j.CleanupAll()
+			j.cleanupAll(false)
 		case s := <-j.signal: // active cleanup
 			j.cleanupTriggered(s)
 		}
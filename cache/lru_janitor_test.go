@@ -26,7 +26,7 @@ func (m *mockState) CleanupCount() int {
 
 func TestStatesJanitor_Add(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	// Test adding states within capacity
@@ -56,29 +56,83 @@ func TestStatesJanitor_Add(t *testing.T) {
 	}
 }
 
-func TestStatesJanitor_AddPanicOnOverflow(t *testing.T) {
+func TestStatesJanitor_AddUnbounded(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
-	// Fill up to capacity
-	for range maxStatesPerJanitor {
-		j.Add(&mockState{}, time.Minute)
+	// Adding more states than the signal buffer holds must not panic
+	for i := range 4 * janitorSignalBuffer {
+		if idx := j.Add(&mockState{}, time.Minute); idx != i {
+			t.Fatalf("Expected state index %d, got %d", i, idx)
+		}
 	}
 
-	// Should panic when trying to add beyond capacity
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("Expected panic when adding too many states")
-		}
-	}()
+	if j.numStates.Load() != 4*janitorSignalBuffer {
+		t.Errorf("Expected numStates to be %d, got %d", 4*janitorSignalBuffer, j.numStates.Load())
+	}
+}
+
+func TestStatesJanitor_Remove(t *testing.T) {
+	j := &statesJanitor{
+		signal: make(chan *state, janitorSignalBuffer),
+	}
+
+	removed := &mockState{}
+	kept := &mockState{}
+	removedIdx := j.Add(removed, time.Minute)
+	j.Add(kept, time.Minute)
+
+	j.Remove(removedIdx)
+	j.Remove(removedIdx) // no-op
+
+	if j.numStates.Load() != 1 {
+		t.Errorf("Expected numStates to be 1, got %d", j.numStates.Load())
+	}
+
+	// Triggering a removed state is a no-op
+	j.TriggerCleanup(removedIdx)
+	select {
+	case <-j.signal:
+		t.Error("Unexpected cleanup signal for removed state")
+	default:
+	}
+
+	j.CleanupAll()
+	if removed.CleanupCount() != 0 {
+		t.Errorf("Expected removed state not to be cleaned up, got %d cleanups", removed.CleanupCount())
+	}
+	if kept.CleanupCount() != 1 {
+		t.Errorf("Expected kept state to have 1 cleanup, got %d", kept.CleanupCount())
+	}
+
+	// Indices are never reused
+	if idx := j.Add(&mockState{}, time.Minute); idx != 2 {
+		t.Errorf("Expected new state index to be 2, got %d", idx)
+	}
+}
+
+func TestStatesJanitor_RemovePendingCleanup(t *testing.T) {
+	j := &statesJanitor{
+		signal: make(chan *state, janitorSignalBuffer),
+	}
+
+	mock := &mockState{}
+	idx := j.Add(mock, time.Minute)
 
-	j.Add(&mockState{}, time.Minute)
+	// A cleanup queued before Remove is skipped
+	j.TriggerCleanup(idx)
+	j.Remove(idx)
+	j.cleanupTriggered(<-j.signal)
+
+	if mock.CleanupCount() != 0 {
+		t.Errorf("Expected no cleanup, got %d", mock.CleanupCount())
+	}
 }
 
 func TestStatesJanitor_TriggerCleanup(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	mock := &mockState{}
@@ -102,7 +156,7 @@ func TestStatesJanitor_TriggerCleanup(t *testing.T) {
 
 func TestStatesJanitor_TriggerCleanupInvalidIndex(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	// Test negative index
@@ -116,7 +170,7 @@ func TestStatesJanitor_TriggerCleanupInvalidIndex(t *testing.T) {
 
 func TestStatesJanitor_TriggerCleanupIndexTooLarge(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	// Test index too large
@@ -130,7 +184,7 @@ func TestStatesJanitor_TriggerCleanupIndexTooLarge(t *testing.T) {
 
 func TestStatesJanitor_CleanupAll(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	mock1 := &mockState{}
@@ -156,7 +210,7 @@ func TestStatesJanitor_CleanupAll(t *testing.T) {
 
 func TestStatesJanitor_CleanupInterval(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	mock := &mockState{}
@@ -187,7 +241,7 @@ func TestStatesJanitor_CleanupInterval(t *testing.T) {
 
 func TestStatesJanitor_ConcurrentCleanup(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	mock := &mockState{}
@@ -231,7 +285,7 @@ func TestStatesJanitor_ConcurrentCleanup(t *testing.T) {
 
 func TestStatesJanitor_TriggerCleanupIdempotent(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	mock := &mockState{}
@@ -265,7 +319,7 @@ func TestStatesJanitor_TriggerCleanupIdempotent(t *testing.T) {
 
 func TestStatesJanitor_CleanupAllWithPendingCleanup(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	mock := &mockState{}
@@ -299,7 +353,7 @@ done:
 
 func TestStatesJanitor_TriggerCleanupCanRunAgainAfterSignalProcessing(t *testing.T) {
 	j := &statesJanitor{
-		signal: make(chan *state, maxStatesPerJanitor),
+		signal: make(chan *state, janitorSignalBuffer),
 	}
 
 	mock := &mockState{}
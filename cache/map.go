@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/yusing/goutils/mockable"
+	"github.com/yusing/goutils/task"
+)
+
+// Map is a concurrent map whose entries expire after a per-entry TTL. It
+// shares the janitor, eviction policies and stats of the cached functions
+// built with CachedKeyFuncBuilder: expired entries are dropped in the
+// background, and WithMaxEntries bounds the map.
+type Map[K comparable, V any] struct {
+	state *CachedContextKeyFuncState[V, K]
+}
+
+// MapBuilder configures a Map, see NewMap.
+type MapBuilder[K comparable, V any] struct {
+	builder CachedKeyFuncBuilder[V, K]
+}
+
+var _ StatsProvider = (*Map[string, any])(nil)
+
+// NewMap creates a new MapBuilder with default options (15 seconds cleanup
+// interval).
+func NewMap[K comparable, V any]() MapBuilder[K, V] {
+	builder := NewKeyFunc[V, K](nil)
+	builder.entryTTL = true
+	return MapBuilder[K, V]{builder: builder}
+}
+
+// WithMaxEntries configures new MapBuilder instance with the given
+// maxEntries.
+func (b MapBuilder[K, V]) WithMaxEntries(maxEntries int) MapBuilder[K, V] {
+	b.builder = b.builder.WithMaxEntries(maxEntries)
+	return b
+}
+
+// WithMaxCost configures new MapBuilder instance to evict entries once the
+// total cost of the values exceeds maxCost, see
+// CachedKeyFuncBuilder.WithMaxCost.
+func (b MapBuilder[K, V]) WithMaxCost(maxCost int64, cost func(key K, value V) int64) MapBuilder[K, V] {
+	b.builder = b.builder.WithMaxCost(maxCost, cost)
+	return b
+}
+
+// WithEvictionPolicy configures new MapBuilder instance to pick the entries
+// to evict with the policy created by factory, see
+// CachedKeyFuncBuilder.WithEvictionPolicy.
+func (b MapBuilder[K, V]) WithEvictionPolicy(factory EvictionPolicyFactory[K]) MapBuilder[K, V] {
+	b.builder = b.builder.WithEvictionPolicy(factory)
+	return b
+}
+
+// WithOnEvict configures new MapBuilder instance to call onEvict whenever a
+// value leaves the map, see CachedKeyFuncBuilder.WithOnEvict.
+func (b MapBuilder[K, V]) WithOnEvict(onEvict func(key K, value V, reason EvictReason)) MapBuilder[K, V] {
+	b.builder = b.builder.WithOnEvict(onEvict)
+	return b
+}
+
+// WithCleanupInterval configures new MapBuilder instance with the given
+// cleanupInterval.
+func (b MapBuilder[K, V]) WithCleanupInterval(cleanupInterval time.Duration) MapBuilder[K, V] {
+	b.builder = b.builder.WithCleanupInterval(cleanupInterval)
+	return b
+}
+
+// WithClock configures new MapBuilder instance to tell the time with clock
+// instead of the real clock, for TTLs and the janitor's cleanups.
+func (b MapBuilder[K, V]) WithClock(clock mockable.Clock) MapBuilder[K, V] {
+	b.builder = b.builder.WithClock(clock)
+	return b
+}
+
+// WithName configures new MapBuilder instance to register the map for
+// RegisteredStats and WritePrometheus under name.
+func (b MapBuilder[K, V]) WithName(name string) MapBuilder[K, V] {
+	b.builder = b.builder.WithName(name)
+	return b
+}
+
+// WithTask configures new MapBuilder instance to close the map once parent
+// is canceled, see Map.Close.
+func (b MapBuilder[K, V]) WithTask(parent task.Parent) MapBuilder[K, V] {
+	b.builder = b.builder.WithTask(parent)
+	return b
+}
+
+func (b MapBuilder[K, V]) Build() *Map[K, V] {
+	m := &Map[K, V]{state: newCachedContextKeyFuncState(b.builder)}
+	if b.builder.name != "" {
+		registerStats(b.builder.name, m)
+	}
+	if b.builder.parent != nil {
+		b.builder.parent.OnCancel(callbackName("close cache map", b.builder.name), m.Close)
+	}
+	return m
+}
+
+// Get returns the value for key. ok is false when key is missing or its
+// value has expired.
+func (m *Map[K, V]) Get(key K) (value V, ok bool) {
+	state := m.state
+	entry, loaded := state.entries.Load(key)
+	if !loaded {
+		state.stats.miss()
+		return value, false
+	}
+	cached := entry.cached.Load()
+	if state.checkExpired(cached) {
+		state.stats.miss()
+		return value, false
+	}
+	state.touchEntry(key, entry)
+	state.stats.hit()
+	return cached.result, true
+}
+
+// Set stores value for key, replacing any previous value. The value expires
+// after ttl, or never when ttl is 0. A GetOrCompute for key already in flight
+// still returns its result but does not overwrite value.
+func (m *Map[K, V]) Set(key K, value V, ttl time.Duration) {
+	state := m.state
+	entry, loaded := state.entries.LoadOrCompute(key, newCacheEntry[V])
+
+	entry.refreshMu.Lock()
+	entry.inflight = nil
+	replaced, hasReplaced := state.storeValue(key, entry, newCachedValue(value, nil, ttl, state.now()))
+	entry.refreshMu.Unlock()
+
+	if hasReplaced {
+		state.notifyEvict(replaced.key, replaced.value, replaced.reason)
+	}
+	state.trackEntry(key, entry, loaded)
+}
+
+// GetOrCompute returns the value for key, or computes, stores and returns
+// it when key is missing or its value has expired. Concurrent calls for the
+// same key run compute once and share its result. An error from compute is
+// returned and nothing is stored; a panic in compute is re-raised in every
+// caller sharing it.
+//
+// compute runs without holding any of the map's locks, so a slow compute
+// only delays the callers for the same key.
+func (m *Map[K, V]) GetOrCompute(key K, ttl time.Duration, compute func() (V, error)) (value V, err error) {
+	if value, ok := m.Get(key); ok {
+		return value, nil
+	}
+
+	state := m.state
+	for {
+		entry, loaded := state.entries.LoadOrCompute(key, newCacheEntry[V])
+
+		entry.refreshMu.Lock()
+		if entry.removed {
+			// deleted while we were waiting for the lock, start over with its replacement
+			entry.refreshMu.Unlock()
+			continue
+		}
+		if cached := entry.cached.Load(); !state.checkExpired(cached) {
+			// computed while we were waiting for the lock
+			entry.refreshMu.Unlock()
+			state.touchEntry(key, entry)
+			return cached.result, nil
+		}
+		call := entry.inflight
+		owner := call == nil
+		if owner {
+			call = &inflightCall[V]{done: make(chan struct{})}
+			entry.inflight = call
+		}
+		entry.refreshMu.Unlock()
+
+		if owner {
+			m.runCompute(key, entry, call, ttl, compute)
+			if call.err == nil && call.panicked == nil {
+				state.trackEntry(key, entry, loaded)
+			}
+		} else {
+			<-call.done
+		}
+		return call.wait()
+	}
+}
+
+// runCompute runs compute for the in-flight call of entry and stores its
+// result unless the call was abandoned by Set or Delete meanwhile.
+func (m *Map[K, V]) runCompute(key K, entry *CacheEntry[V], call *inflightCall[V], ttl time.Duration, compute func() (V, error)) {
+	state := m.state
+	defer func() {
+		// re-raised by the callers sharing the call once it is done
+		call.panicked = recover()
+
+		var (
+			replaced    droppedValue[V, K]
+			hasReplaced bool
+		)
+		entry.refreshMu.Lock()
+		if entry.inflight == call {
+			entry.inflight = nil
+			switch {
+			case call.err == nil && call.panicked == nil:
+				replaced, hasReplaced = state.storeValue(key, entry, newCachedValue(call.result, nil, ttl, state.now()))
+			case entry.cached.Load() == nil:
+				// do not leave an empty entry behind
+				state.entries.Compute(key, func(current *CacheEntry[V], loaded bool) (*CacheEntry[V], xsync.ComputeOp) {
+					if loaded && current == entry {
+						return current, xsync.DeleteOp
+					}
+					return current, xsync.CancelOp
+				})
+				state.releaseLocked(entry)
+			}
+		}
+		close(call.done)
+		entry.refreshMu.Unlock()
+
+		if hasReplaced {
+			state.notifyEvict(replaced.key, replaced.value, replaced.reason)
+		}
+	}()
+
+	start := time.Now()
+	defer func() { state.stats.recordLoad(start, call.err) }()
+	call.result, call.err = compute()
+}
+
+// Delete removes key, reporting its value to OnEvict.
+func (m *Map[K, V]) Delete(key K) {
+	m.state.invalidate(key)
+}
+
+// Range calls yield for every key holding a value that has not expired,
+// until yield returns false. It can be used in a for-range loop.
+func (m *Map[K, V]) Range(yield func(key K, value V) bool) {
+	for key, entry := range m.state.entries.Range {
+		cached := entry.cached.Load()
+		if m.state.checkExpired(cached) {
+			continue
+		}
+		if !yield(key, cached.result) {
+			return
+		}
+	}
+}
+
+// Stats returns a snapshot of the map's counters.
+func (m *Map[K, V]) Stats() Stats {
+	return m.state.Stats()
+}
+
+// Close unregisters the map from Janitor and from RegisteredStats, and
+// deletes every entry. See KeyFuncHandle.Close.
+func (m *Map[K, V]) Close() {
+	m.state.close(m)
+}
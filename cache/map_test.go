@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/mockable"
+)
+
+func TestMap_GetSetDelete(t *testing.T) {
+	m := NewMap[string, int]().Build()
+	t.Cleanup(m.Close)
+
+	_, ok := m.Get("a")
+	assert.False(t, ok)
+
+	m.Set("a", 1, 0)
+	m.Set("b", 2, time.Hour)
+	value, ok := m.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	m.Set("a", 10, 0)
+	value, _ = m.Get("a")
+	assert.Equal(t, 10, value)
+
+	m.Delete("a")
+	_, ok = m.Get("a")
+	assert.False(t, ok)
+
+	stats := m.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Evictions[EvictReasonReplaced])
+	assert.Equal(t, uint64(1), stats.Evictions[EvictReasonInvalidated])
+	assert.Equal(t, 1, stats.Size)
+}
+
+func TestMap_Expiry(t *testing.T) {
+	var recorder evictRecorder
+	m := NewMap[string, string]().WithOnEvict(recorder.onEvict).Build()
+	t.Cleanup(m.Close)
+
+	m.Set("short", "1", 10*time.Millisecond)
+	m.Set("long", "2", time.Hour)
+	m.Set("forever", "3", 0)
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok := m.Get("short")
+	assert.False(t, ok, "expired values are not returned")
+	assert.Equal(t, map[string]string{"long": "2", "forever": "3"}, maps.Collect(m.Range))
+
+	// the janitor drops expired entries in the background
+	m.state.Cleanup()
+	assert.Equal(t, []evictedValue{{"short", "1", EvictReasonExpired}}, recorder.take())
+	assert.Equal(t, 2, m.Stats().Size)
+}
+
+func TestMap_GetOrCompute(t *testing.T) {
+	m := NewMap[string, int]().Build()
+	t.Cleanup(m.Close)
+
+	var calls atomic.Int32
+	compute := func() (int, error) {
+		time.Sleep(10 * time.Millisecond)
+		return int(calls.Add(1)), nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			value, err := m.GetOrCompute("a", time.Hour, compute)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, value)
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load(), "concurrent calls share one computation")
+
+	testErr := errors.New("test error")
+	_, err := m.GetOrCompute("b", time.Hour, func() (int, error) { return 0, testErr })
+	require.ErrorIs(t, err, testErr)
+	_, ok := m.Get("b")
+	assert.False(t, ok, "errors are not stored")
+	assert.Equal(t, 1, m.Stats().Size, "no empty entry is left behind")
+	assert.Equal(t, uint64(2), m.Stats().Loads)
+}
+
+func TestMap_GetOrComputePanic(t *testing.T) {
+	m := NewMap[string, int]().Build()
+	t.Cleanup(m.Close)
+
+	require.PanicsWithValue(t, "boom", func() {
+		_, _ = m.GetOrCompute("a", time.Hour, func() (int, error) { panic("boom") })
+	})
+
+	done := make(chan struct{})
+	go func() {
+		m.state.Cleanup()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup blocked by the entry of a panicked compute")
+	}
+
+	value, err := m.GetOrCompute("a", time.Hour, func() (int, error) { return 1, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, value, "the key is computed again after a panic")
+}
+
+func TestMap_GetOrComputeSlowDoesNotBlockCleanup(t *testing.T) {
+	m := NewMap[string, int]().Build()
+	t.Cleanup(m.Close)
+
+	m.Set("expired", 1, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	computed := make(chan int)
+	go func() {
+		value, _ := m.GetOrCompute("slow", time.Hour, func() (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		computed <- value
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		m.state.Cleanup()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup blocked by a slow compute")
+	}
+	_, ok := m.state.entries.Load("expired")
+	assert.False(t, ok, "cleanup swept the expired entry")
+
+	close(release)
+	assert.Equal(t, 1, <-computed)
+	value, ok := m.Get("slow")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+}
+
+func TestMap_MaxEntries(t *testing.T) {
+	m := NewMap[int, int]().WithMaxEntries(2).WithEvictionPolicy(NewLRUPolicy[int]).Build()
+	t.Cleanup(m.Close)
+
+	m.Set(1, 1, 0)
+	m.Set(2, 2, 0)
+	m.Get(1)
+	m.Set(3, 3, 0)
+	m.state.Cleanup()
+
+	assert.Equal(t, map[int]int{1: 1, 3: 3}, maps.Collect(m.Range))
+	assert.Equal(t, uint64(1), m.Stats().Evictions[EvictReasonCapacity])
+}
+
+func TestMap_Close(t *testing.T) {
+	m := NewMap[string, int]().WithName(t.Name()).Build()
+	m.Set("a", 1, 0)
+	require.Contains(t, RegisteredStats(), t.Name())
+
+	m.Close()
+	assert.NotContains(t, RegisteredStats(), t.Name())
+	assert.Zero(t, m.Stats().Size)
+	Janitor.mu.RLock()
+	assert.NotContains(t, Janitor.states, m.state.janitorIdx)
+	Janitor.mu.RUnlock()
+}
+
+func TestMap_WithClock(t *testing.T) {
+	clock := mockable.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var recorder evictRecorder
+	m := NewMap[string, string]().
+		WithClock(clock).
+		WithCleanupInterval(time.Minute).
+		WithOnEvict(recorder.onEvict).
+		Build()
+	t.Cleanup(m.Close)
+
+	m.Set("a", "1", time.Hour)
+	m.Set("b", "2", time.Hour+90*time.Second)
+	clock.Advance(time.Hour + time.Second)
+	_, ok := m.Get("a")
+	assert.False(t, ok)
+	value, ok := m.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, "2", value)
+	assert.Empty(t, recorder.take(), "not swept before the next cleanup")
+
+	// the janitor sweeps every cleanup interval of the clock
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, []evictedValue{{"a", "1", EvictReasonExpired}}, recorder.take())
+
+	clock.Advance(59 * time.Second)
+	assert.Empty(t, recorder.take(), "cleaned up again before the interval")
+	clock.Advance(time.Second)
+	assert.Equal(t, []evictedValue{{"b", "2", EvictReasonExpired}}, recorder.take())
+
+	// no more sweeps once the map is closed
+	m.Set("c", "3", time.Second)
+	m.Close()
+	assert.Equal(t, []evictedValue{{"c", "3", EvictReasonInvalidated}}, recorder.take())
+	clock.Advance(time.Hour)
+	assert.Empty(t, recorder.take())
+}
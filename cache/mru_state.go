@@ -3,13 +3,15 @@ package cache
 import (
 	"cmp"
 	"context"
+	"errors"
+	"fmt"
 	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/cenkalti/backoff/v5"
 	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
 )
 
 type CacheEntry[T any] struct {
@@ -17,6 +19,25 @@ type CacheEntry[T any] struct {
 	cached    atomic.Pointer[cachedValue[T]]
 	accessSeq atomic.Uint64
 	queuedSeq atomic.Uint64
+
+	// guarded by refreshMu
+	inflight *inflightCall[T]
+	cost     int64
+	removed  bool
+}
+
+// inflightCall is a computation shared by every caller that missed the same
+// key while it runs.
+type inflightCall[T any] struct {
+	done       chan struct{}
+	cancel     context.CancelCauseFunc
+	waiters    int // guarded by CacheEntry.refreshMu
+	revalidate bool
+
+	// set before done is closed
+	result   T
+	err      error
+	panicked any
 }
 
 type CachedContextKeyFuncState[T any, K comparable] struct {
@@ -32,6 +53,25 @@ type CachedContextKeyFuncState[T any, K comparable] struct {
 	cleanupMu   sync.Mutex
 
 	janitorIdx int
+
+	// set when WithEvictionPolicy is used, replacing the access log scheme
+	policy    EvictionPolicy[K]
+	policyMu  sync.Mutex
+	accessBuf accessBuffer[K]
+
+	totalCost atomic.Int64
+
+	// values dropped by the current Cleanup pass, reported to onEvict once
+	// it releases cleanupMu
+	dropped []droppedValue[T, K]
+
+	stats cacheStats
+}
+
+type droppedValue[T any, K comparable] struct {
+	key    K
+	value  T
+	reason EvictReason
 }
 
 type cleanupCandidate[K comparable] struct {
@@ -50,37 +90,121 @@ func newCachedContextKeyFuncState[T any, K comparable](builder CachedKeyFuncBuil
 	state := &CachedContextKeyFuncState[T, K]{
 		CachedKeyFuncBuilder: builder,
 		entries:              xsync.NewMap[K, *CacheEntry[T]](),
+		janitorIdx:           -1,
 		accessLog:            make([]cleanupCandidate[K], 0, accessLogCap),
 	}
-	// cleanup is only needed if maxEntries is set
-	if state.maxEntries > 0 {
+	if state.bounded() && builder.evictionPolicy != nil {
+		capacity := state.maxEntries
+		if capacity == 0 {
+			capacity = defaultPolicyCapacity
+		}
+		state.policy = builder.evictionPolicy(capacity)
+	}
+	// cleanup is only needed if the cache is bounded or expired values must be reported
+	if state.bounded() || state.sweepsExpired() {
 		state.janitorIdx = Janitor.Add(state, state.cleanupInterval)
 	}
 	return state
 }
 
 func (state *CachedContextKeyFuncState[T, K]) checkExpired(cached *cachedValue[T]) bool {
-	if cached == nil {
-		return true
-	}
-	if state.ttl == 0 {
-		return false
-	}
-	return time.Now().After(cached.expireAt)
+	return cached.expired(&state.CachedFuncConfig)
 }
 
 func (state *CachedContextKeyFuncState[T, K]) Cleanup() {
 	// Cleanup is the single consumer for the access log scratch buffers. Multiple callers may
 	// race to request cleanup, but only one pass may swap/sort/restore logs at a time.
 	state.cleanupMu.Lock()
-	defer state.cleanupMu.Unlock()
+	if state.sweepsExpired() {
+		state.sweepExpired()
+	}
+	if state.bounded() {
+		state.trim()
+	}
+	dropped := state.dropped
+	state.dropped = nil
+	state.cleanupMu.Unlock()
+
+	for _, d := range dropped {
+		state.notifyEvict(d.key, d.value, d.reason)
+	}
+}
 
-	if state.maxEntries == 0 { // should not happen, but just in case
+// invalidate drops the entry for key and reports its value to onEvict.
+func (state *CachedContextKeyFuncState[T, K]) invalidate(key K) {
+	if removed, ok := state.entries.LoadAndDelete(key); ok {
+		cached := state.release(removed)
+		state.forgetEntry(key)
+		state.stats.evicted(EvictReasonInvalidated)
+		if state.reportable(cached) {
+			state.notifyEvict(key, cached.result, EvictReasonInvalidated)
+		}
+	}
+}
+
+func (state *CachedContextKeyFuncState[T, K]) invalidateAll() {
+	for key := range state.entries.Range {
+		state.invalidate(key)
+	}
+}
+
+// close unregisters the state from Janitor and provider from the stats
+// registry, then drops every entry.
+func (state *CachedContextKeyFuncState[T, K]) close(provider StatsProvider) {
+	if state.janitorIdx >= 0 {
+		Janitor.Remove(state.janitorIdx)
+	}
+	if state.name != "" {
+		unregisterStats(state.name, provider)
+	}
+	state.invalidateAll()
+}
+
+// sweepExpired drops the entries that expired and can no longer be served
+// stale, so their values are reported to onEvict. The caller must hold
+// cleanupMu.
+func (state *CachedContextKeyFuncState[T, K]) sweepExpired() {
+	for key, entry := range state.entries.Range {
+		entry.refreshMu.Lock()
+		cached := entry.cached.Load()
+		if cached == nil || entry.inflight != nil || !state.checkExpired(cached) || cached.servableStale(&state.CachedFuncConfig) {
+			entry.refreshMu.Unlock()
+			continue
+		}
+		deleted := false
+		state.entries.Compute(key, func(current *CacheEntry[T], loaded bool) (*CacheEntry[T], xsync.ComputeOp) {
+			if loaded && current == entry {
+				deleted = true
+				return current, xsync.DeleteOp
+			}
+			return current, xsync.CancelOp
+		})
+		if deleted {
+			state.releaseLocked(entry)
+		}
+		entry.refreshMu.Unlock()
+
+		if deleted {
+			state.forgetEntry(key)
+			state.stats.evicted(EvictReasonExpired)
+			state.drop(key, cached, EvictReasonExpired)
+		}
+	}
+}
+
+// trim evicts entries until the cache is back within maxEntries and maxCost.
+// The caller must hold cleanupMu.
+func (state *CachedContextKeyFuncState[T, K]) trim() {
+	overflow := 0
+	if state.maxEntries > 0 {
+		overflow = state.entries.Size() - state.maxEntries
+	}
+	if overflow <= 0 && !state.overCost() {
 		return
 	}
 
-	overflow := state.entries.Size() - state.maxEntries
-	if overflow <= 0 {
+	if state.policy != nil {
+		state.cleanupWithPolicy(overflow)
 		return
 	}
 
@@ -121,7 +245,7 @@ func (state *CachedContextKeyFuncState[T, K]) Cleanup() {
 
 	survivors := current[:0]
 	for _, candidate := range current {
-		if overflow <= 0 {
+		if overflow <= 0 && !state.overCost() {
 			survivors = append(survivors, candidate)
 			continue
 		}
@@ -141,12 +265,7 @@ func (state *CachedContextKeyFuncState[T, K]) Cleanup() {
 		// Deleting here only races with that enqueue path; a later load either sees no entry or
 		// a replacement entry, and stale candidates are ignored by the Load/accessSeq checks above.
 		if removed, ok := state.entries.LoadAndDelete(candidate.key); ok {
-			evicted := cacheEvictedKV{key: candidate.key}
-			if cached := removed.cached.Load(); cached != nil {
-				evicted.result = cached.result
-				evicted.err = cached.err
-			}
-			logCacheEvicted(state.maxEntries, state.entries.Size(), evicted)
+			state.evicted(candidate.key, removed)
 			overflow--
 		}
 	}
@@ -154,10 +273,166 @@ func (state *CachedContextKeyFuncState[T, K]) Cleanup() {
 	state.restoreAccessLog(survivors)
 }
 
+// cleanupWithPolicy evicts overflow entries in the order chosen by the
+// configured EvictionPolicy.
+func (state *CachedContextKeyFuncState[T, K]) cleanupWithPolicy(overflow int) {
+	accesses := state.accessBuf.swap()
+
+	state.policyMu.Lock()
+	defer state.policyMu.Unlock()
+
+	for _, key := range accesses {
+		state.policy.Access(key)
+	}
+	for overflow > 0 || state.overCost() {
+		key, ok := state.policy.Evict()
+		if !ok {
+			return
+		}
+		if removed, ok := state.entries.LoadAndDelete(key); ok {
+			state.evicted(key, removed)
+			overflow--
+		}
+	}
+}
+
+// evicted records that Cleanup dropped key to respect maxEntries or maxCost.
+func (state *CachedContextKeyFuncState[T, K]) evicted(key K, removed *CacheEntry[T]) {
+	cached := state.release(removed)
+	state.drop(key, cached, EvictReasonCapacity)
+	evicted := cacheEvictedKV{key: key}
+	if cached != nil {
+		evicted.result = cached.result
+		evicted.err = cached.err
+	}
+	state.stats.evicted(EvictReasonCapacity)
+	logCacheEvicted(state.maxEntries, state.entries.Size(), evicted)
+}
+
+// defaultPolicyCapacity is the capacity hint given to an eviction policy
+// when only WithMaxCost bounds the cache.
+const defaultPolicyCapacity = 1024
+
+// sweepsExpired reports whether Cleanup must drop expired entries, either
+// because they are set with their own TTL or so their values are reported
+// to onEvict.
+func (state *CachedContextKeyFuncState[T, K]) sweepsExpired() bool {
+	if state.entryTTL {
+		return true
+	}
+	return state.onEvict != nil && (state.ttl > 0 || state.errorTTL > 0)
+}
+
+// bounded reports whether the cache evicts entries at all.
+func (state *CachedContextKeyFuncState[T, K]) bounded() bool {
+	return state.maxEntries > 0 || state.maxCost > 0
+}
+
+func (state *CachedContextKeyFuncState[T, K]) overCost() bool {
+	return state.maxCost > 0 && state.totalCost.Load() > state.maxCost
+}
+
+// storeValue publishes cached as entry's value and accounts for its cost. It
+// returns the value it replaced when that must be reported to onEvict. The
+// caller must hold entry.refreshMu, report the replaced value once it
+// released the lock, and call trackEntry afterwards so an over-budget cache
+// gets trimmed.
+//
+// Nothing is stored into an entry that already left the cache: its value
+// would never be served nor reported.
+func (state *CachedContextKeyFuncState[T, K]) storeValue(key K, entry *CacheEntry[T], cached *cachedValue[T]) (replaced droppedValue[T, K], ok bool) {
+	if entry.removed {
+		return replaced, false
+	}
+	old := entry.cached.Swap(cached)
+	reason := EvictReasonExpired
+	if old != nil && !state.checkExpired(old) {
+		reason = EvictReasonReplaced
+		state.stats.evicted(reason)
+	}
+	if state.maxCost > 0 {
+		var cost int64
+		if cached.err == nil {
+			cost = state.costFn(key, cached.result)
+		}
+		state.totalCost.Add(cost - entry.cost)
+		entry.cost = cost
+	}
+	if !state.reportable(old) {
+		return replaced, false
+	}
+	return droppedValue[T, K]{key: key, value: old.result, reason: reason}, true
+}
+
+// release marks an entry that was removed from the map as gone, gives back
+// its cost and returns its last value.
+func (state *CachedContextKeyFuncState[T, K]) release(entry *CacheEntry[T]) *cachedValue[T] {
+	entry.refreshMu.Lock()
+	defer entry.refreshMu.Unlock()
+	return state.releaseLocked(entry)
+}
+
+// releaseLocked is release for callers already holding entry.refreshMu.
+func (state *CachedContextKeyFuncState[T, K]) releaseLocked(entry *CacheEntry[T]) *cachedValue[T] {
+	entry.removed = true
+	state.totalCost.Add(-entry.cost)
+	entry.cost = 0
+	return entry.cached.Load()
+}
+
+// reportable reports whether cached holds a value onEvict must hear about.
+// Cached errors hold no resources and are not reported.
+func (state *CachedContextKeyFuncState[T, K]) reportable(cached *cachedValue[T]) bool {
+	return state.onEvict != nil && cached != nil && cached.err == nil
+}
+
+// drop queues cached for onEvict at the end of the current Cleanup pass.
+// The caller must hold cleanupMu.
+func (state *CachedContextKeyFuncState[T, K]) drop(key K, cached *cachedValue[T], reason EvictReason) {
+	if state.reportable(cached) {
+		state.dropped = append(state.dropped, droppedValue[T, K]{key: key, value: cached.result, reason: reason})
+	}
+}
+
+// notifyEvict invokes onEvict, recovering and logging a panic so a faulty
+// callback cannot break the caller. It must be called without holding any
+// of the state's locks.
+func (state *CachedContextKeyFuncState[T, K]) notifyEvict(key K, value T, reason EvictReason) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Err(fmtCause(err)).Str("reason", reason.String()).Msg("cache: OnEvict panic")
+			panicWithDebugStack()
+		}
+	}()
+	state.onEvict(key, value, reason)
+}
+
+func fmtCause(cause any) error {
+	switch cause := cause.(type) {
+	case error:
+		return cause
+	case string:
+		return errors.New(cause)
+	default:
+		return fmt.Errorf("%v", cause)
+	}
+}
+
 func newCacheEntry[T any]() (entry *CacheEntry[T], cancel bool) {
 	return &CacheEntry[T]{}, false
 }
 
+// callContext returns the cached value for key, computing it on a miss or
+// after expiry.
+//
+// Concurrent misses for the same key share a single computation: the first
+// caller publishes an in-flight call on the CacheEntry and every other caller
+// joins it as a waiter, so fn runs exactly once per refresh. The computation
+// runs detached from any single caller's cancellation. A waiter whose context
+// is done stops waiting and returns its context cause without affecting the
+// others; only when the last waiter leaves is the computation canceled. The
+// result of an abandoned computation is discarded, even if fn ignores the
+// cancellation and succeeds, and the next caller starts a new one.
 func (state *CachedContextKeyFuncState[T, K]) callContext(ctx context.Context, key K) (T, error) {
 	entry, loaded := state.entries.LoadOrCompute(key, newCacheEntry[T])
 	if loaded {
@@ -166,8 +441,15 @@ func (state *CachedContextKeyFuncState[T, K]) callContext(ctx context.Context, k
 		// in-flight first compute as a zero-value/expired hit.
 		if cached := entry.cached.Load(); !state.checkExpired(cached) {
 			state.touchEntry(key, entry)
+			state.stats.hit()
 			logCacheHit(key, cached.result, cached.err)
 			return cached.result, cached.err
+		} else if cached.servableStale(&state.CachedFuncConfig) {
+			state.touchEntry(key, entry)
+			state.stats.hit()
+			logCacheStaleHit(key, cached.result)
+			state.revalidate(ctx, key, entry)
+			return cached.result, nil
 		}
 	} else {
 		logCacheMiss(key)
@@ -175,85 +457,195 @@ func (state *CachedContextKeyFuncState[T, K]) callContext(ctx context.Context, k
 	}
 
 	entry.refreshMu.Lock()
-	defer entry.refreshMu.Unlock()
-
 	cached := entry.cached.Load()
 	if !state.checkExpired(cached) {
+		entry.refreshMu.Unlock()
 		state.touchEntry(key, entry)
+		state.stats.hit()
 		logCacheHit(key, cached.result, cached.err)
 		return cached.result, cached.err
 	}
-	if loaded && cached != nil {
-		logCacheExpiredEntry(key, cached.result, cached.err)
-	}
-
-	result, err := state.execute(ctx, key)
-	if shouldCacheResult(ctx, err) {
-		cached := &cachedValue[T]{
-			result: result,
-			err:    err,
-		}
-		if state.ttl > 0 {
-			cached.expireAt = time.Now().Add(state.ttl)
+	state.stats.miss()
+	call := entry.inflight
+	if call == nil {
+		if loaded && cached != nil {
+			state.stats.evicted(EvictReasonExpired)
+			logCacheExpiredEntry(key, cached.result, cached.err)
 		}
-		entry.cached.Store(cached)
+		call = state.startCall(ctx, key, entry, false)
 	}
+	call.waiters++
+	entry.refreshMu.Unlock()
 
-	state.touchEntry(key, entry)
-	if state.maxEntries > 0 && !loaded && state.entries.Size() > state.maxEntries {
-		Janitor.TriggerCleanup(state.janitorIdx)
-	}
+	result, err := state.waitCall(ctx, entry, call)
 
+	state.trackEntry(key, entry, loaded)
 	return result, err
 }
 
-func (state *CachedContextKeyFuncState[T, K]) newBackoff() backoff.BackOff {
-	if state.backoffFactory == nil {
-		return &backoff.ZeroBackOff{}
+// revalidate refreshes an entry in the background unless a refresh for it is
+// already in flight. It follows the same rules as CachedFuncState.revalidate.
+func (state *CachedContextKeyFuncState[T, K]) revalidate(ctx context.Context, key K, entry *CacheEntry[T]) {
+	entry.refreshMu.Lock()
+	defer entry.refreshMu.Unlock()
+
+	if entry.inflight != nil || !state.checkExpired(entry.cached.Load()) {
+		return
 	}
-	return state.backoffFactory()
+	state.startCall(ctx, key, entry, true)
 }
 
-func (state *CachedContextKeyFuncState[T, K]) execute(ctx context.Context, key K) (T, error) {
-	result, err := state.fn(ctx, key)
-	if err == nil || state.retries == 0 {
-		return result, err
+// startCall publishes a new in-flight computation for key and runs it in the
+// background, detached from ctx's cancellation. Foreground calls are
+// canceled by their last waiter instead; revalidations have no waiters and
+// are bounded as described in revalidateContext. The caller must hold
+// entry.refreshMu.
+func (state *CachedContextKeyFuncState[T, K]) startCall(ctx context.Context, key K, entry *CacheEntry[T], revalidate bool) *inflightCall[T] {
+	stop := func() {}
+	if revalidate {
+		ctx, stop = revalidateContext(ctx, state.parent)
+	} else {
+		ctx = context.WithoutCancel(ctx)
 	}
+	callCtx, cancel := context.WithCancelCause(ctx)
+	call := &inflightCall[T]{
+		done: make(chan struct{}),
+		cancel: func(cause error) {
+			cancel(cause)
+			stop()
+		},
+		revalidate: revalidate,
+	}
+	entry.inflight = call
+	go state.runCall(callCtx, key, entry, call)
+	return call
+}
 
-	retries := state.retries
-	retryBackoff := state.newBackoff()
-
-	for retries > 0 {
-		select {
-		case <-ctx.Done():
-			return result, context.Cause(ctx)
-		default:
-			retries--
-			delay := retryBackoff.NextBackOff()
-			if delay == backoff.Stop {
-				return result, err
-			}
-			if err := waitForBackoff(ctx, delay); err != nil {
-				return result, err
+func (state *CachedContextKeyFuncState[T, K]) runCall(ctx context.Context, key K, entry *CacheEntry[T], call *inflightCall[T]) {
+	defer call.cancel(nil)
+	defer func() {
+		// re-raised by the waiters, a panic must not crash the process from a goroutine nobody owns
+		call.panicked = recover()
+
+		var (
+			replaced    droppedValue[T, K]
+			hasReplaced bool
+		)
+		entry.refreshMu.Lock()
+		// an abandoned call has been replaced or canceled, its result is stale
+		if entry.inflight == call {
+			entry.inflight = nil
+			// a failed revalidation keeps the stale value
+			if call.panicked == nil && state.shouldCache(ctx, call.err) && (call.err == nil || !call.revalidate) {
+				replaced, hasReplaced = state.storeValue(key, entry, newCachedValue(call.result, call.err, state.resultTTL(call.err), state.now()))
 			}
+		}
+		close(call.done)
+		entry.refreshMu.Unlock()
 
-			result, err = state.fn(ctx, key)
-			if err == nil {
-				return result, nil
-			}
+		if hasReplaced {
+			state.notifyEvict(replaced.key, replaced.value, replaced.reason)
 		}
+	}()
+
+	call.result, call.err = state.execute(ctx, key)
+}
+
+// waitCall waits for call to finish or for ctx to be done, whichever comes
+// first. The caller must have registered itself as a waiter of call.
+func (state *CachedContextKeyFuncState[T, K]) waitCall(ctx context.Context, entry *CacheEntry[T], call *inflightCall[T]) (T, error) {
+	select {
+	case <-call.done:
+		return call.wait()
+	case <-ctx.Done():
 	}
 
-	return result, err
+	entry.refreshMu.Lock()
+	select {
+	case <-call.done:
+		// finished while we were giving up
+		entry.refreshMu.Unlock()
+		return call.wait()
+	default:
+	}
+	call.waiters--
+	last := call.waiters == 0
+	if last {
+		// nobody wants the result anymore: let the next caller start over
+		if entry.inflight == call {
+			entry.inflight = nil
+		}
+		call.cancel(context.Cause(ctx))
+	}
+	entry.refreshMu.Unlock()
+
+	var zero T
+	return zero, context.Cause(ctx)
+}
+
+func (call *inflightCall[T]) wait() (T, error) {
+	if call.panicked != nil {
+		panic(call.panicked)
+	}
+	return call.result, call.err
+}
+
+// Stats returns a snapshot of the state's counters.
+func (state *CachedContextKeyFuncState[T, K]) Stats() Stats {
+	stats := state.stats.snapshot(state.entries.Size())
+	stats.Cost = state.totalCost.Load()
+	return stats
+}
+
+func (state *CachedContextKeyFuncState[T, K]) execute(ctx context.Context, key K) (result T, err error) {
+	start := time.Now()
+	defer func() { state.stats.recordLoad(start, err) }()
+
+	return executeWithRetries(ctx, &state.CachedFuncConfig, func(ctx context.Context) (T, error) {
+		return state.fn(ctx, key)
+	})
 }
 
 func (state *CachedContextKeyFuncState[T, K]) nextAccessSeq() uint64 {
 	return state.accessSeq.Add(1)
 }
 
+// trackEntry records an access to an entry that existed (loaded) or an
+// insertion of a new one, triggering cleanup once the cache overflows its
+// entry or cost budget.
+func (state *CachedContextKeyFuncState[T, K]) trackEntry(key K, entry *CacheEntry[T], loaded bool) {
+	if !state.bounded() {
+		return
+	}
+	if loaded || state.policy == nil {
+		state.touchEntry(key, entry)
+	} else {
+		state.policyMu.Lock()
+		state.policy.Add(key)
+		state.policyMu.Unlock()
+	}
+	if (state.maxEntries > 0 && state.entries.Size() > state.maxEntries) || state.overCost() {
+		Janitor.TriggerCleanup(state.janitorIdx)
+	}
+}
+
+// forgetEntry tells the eviction policy, if any, that key left the cache.
+func (state *CachedContextKeyFuncState[T, K]) forgetEntry(key K) {
+	if state.policy == nil {
+		return
+	}
+	state.policyMu.Lock()
+	state.policy.Remove(key)
+	state.policyMu.Unlock()
+}
+
 // touchEntry records that an entry was recently accessed without taking a global lock.
 func (state *CachedContextKeyFuncState[T, K]) touchEntry(key K, entry *CacheEntry[T]) {
-	if state.maxEntries == 0 {
+	if !state.bounded() {
+		return
+	}
+	if state.policy != nil {
+		state.recordAccess(key)
 		return
 	}
 	seq := state.nextAccessSeq()
@@ -308,6 +700,46 @@ func (state *CachedContextKeyFuncState[T, K]) restoreAccessLog(log []cleanupCand
 	state.accessLogMu.Unlock()
 }
 
+// accessBufferSize is how many policy accesses are batched before they are
+// applied under the policy lock.
+const accessBufferSize = 64
+
+// accessBuffer batches policy accesses so hits never wait for the policy
+// lock. It is lossy: an access recorded while the buffer or the policy is
+// busy is dropped, which only makes the policy's view slightly less precise.
+type accessBuffer[K comparable] struct {
+	mu   sync.Mutex
+	keys []K
+}
+
+func (buf *accessBuffer[K]) swap() []K {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+	keys := buf.keys
+	buf.keys = nil
+	return keys
+}
+
+func (state *CachedContextKeyFuncState[T, K]) recordAccess(key K) {
+	buf := &state.accessBuf
+	if !buf.mu.TryLock() {
+		return
+	}
+	defer buf.mu.Unlock()
+
+	if len(buf.keys) >= accessBufferSize {
+		if !state.policyMu.TryLock() {
+			return
+		}
+		for _, key := range buf.keys {
+			state.policy.Access(key)
+		}
+		state.policyMu.Unlock()
+		buf.keys = buf.keys[:0]
+	}
+	buf.keys = append(buf.keys, key)
+}
+
 func initialAccessLogCap(maxEntries int) int {
 	if maxEntries <= 0 {
 		return 64
@@ -161,9 +161,10 @@ func TestCachedContextKeyFuncState_RetryExhausted(t *testing.T) {
 }
 
 func TestCachedContextKeyFuncState_ContextCancellation(t *testing.T) {
-	callCounts := make(map[int]int)
+	// fn may still be running when the canceled caller returns
+	var calls atomic.Int32
 	fn := func(ctx context.Context, key int) (string, error) {
-		callCounts[key]++
+		calls.Add(1)
 		select {
 		case <-ctx.Done():
 			return "", ctx.Err()
@@ -183,7 +184,7 @@ func TestCachedContextKeyFuncState_ContextCancellation(t *testing.T) {
 	assert.ErrorIs(t, err, context.DeadlineExceeded)
 	assert.Empty(t, result)
 	// Function should have been called multiple times before context cancellation
-	assert.GreaterOrEqual(t, callCounts[1], 1)
+	assert.GreaterOrEqual(t, calls.Load(), int32(1))
 }
 
 func TestCachedContextKeyFuncState_ContextCancellationDuringBackoffSleep(t *testing.T) {
@@ -359,6 +360,189 @@ func TestCachedContextKeyFuncState_ColdKeyConcurrentNeverReturnsIntZero(t *testi
 	}
 }
 
+func TestCachedContextKeyFuncState_SingleflightWaiterCancellation(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	computeErr := make(chan error, 1)
+	fn := func(ctx context.Context, key int) (int, error) {
+		calls.Add(1)
+		close(started)
+		select {
+		case <-release:
+			computeErr <- nil
+			return 42, nil
+		case <-ctx.Done():
+			computeErr <- context.Cause(ctx)
+			return 0, context.Cause(ctx)
+		}
+	}
+
+	cachedFunc := NewKeyFunc(fn).Build()
+
+	leaverCtx, leave := context.WithCancel(t.Context())
+	leaverDone := make(chan error, 1)
+	go func() {
+		_, err := cachedFunc(leaverCtx, 1)
+		leaverDone <- err
+	}()
+	<-started
+
+	const stayers = 8
+	var wg sync.WaitGroup
+	results := make([]int, stayers)
+	errs := make([]error, stayers)
+	for i := range stayers {
+		wg.Go(func() {
+			results[i], errs[i] = cachedFunc(t.Context(), 1)
+		})
+	}
+	// let every stayer join the call before the first waiter leaves
+	time.Sleep(20 * time.Millisecond)
+
+	leave()
+	select {
+	case err := <-leaverDone:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("canceled waiter did not stop waiting")
+	}
+
+	// the computation is still running for the remaining waiters
+	select {
+	case err := <-computeErr:
+		t.Fatalf("shared computation was canceled by a single waiter: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	wg.Wait()
+	for i := range stayers {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, 42, results[i])
+	}
+	assert.NoError(t, <-computeErr)
+	assert.Equal(t, int32(1), calls.Load(), "concurrent misses should run fn exactly once")
+}
+
+func TestCachedContextKeyFuncState_SingleflightCanceledWhenAllWaitersLeave(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{}, 2)
+	computeErr := make(chan error, 2)
+	fn := func(ctx context.Context, key int) (int, error) {
+		if calls.Add(1) > 1 {
+			return 7, nil
+		}
+		started <- struct{}{}
+		<-ctx.Done()
+		computeErr <- context.Cause(ctx)
+		return 0, context.Cause(ctx)
+	}
+
+	cachedFunc := NewKeyFunc(fn).Build()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	const waiters = 4
+	var wg sync.WaitGroup
+	errs := make([]error, waiters)
+	for i := range waiters {
+		wg.Go(func() {
+			_, errs[i] = cachedFunc(ctx, 1)
+		})
+	}
+	<-started
+	// let every waiter join the call
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	for i := range waiters {
+		assert.ErrorIs(t, errs[i], context.Canceled)
+	}
+	select {
+	case err := <-computeErr:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("computation was not canceled after every waiter left")
+	}
+
+	// the abandoned call must not be joined or cached: the next caller computes again
+	result, err := cachedFunc(t.Context(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, result)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCachedContextKeyFuncState_SingleflightLastWaiterDoesNotWaitForFn(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	fn := func(ctx context.Context, key int) (int, error) {
+		if calls.Add(1) > 1 {
+			return 7, nil
+		}
+		defer close(finished)
+		close(started)
+		// ignores ctx
+		<-release
+		return 42, nil
+	}
+
+	cachedFunc := NewKeyFunc(fn).Build()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		_, err := cachedFunc(ctx, 1)
+		done <- err
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("canceled caller waited for fn to return")
+	}
+
+	close(release)
+	<-finished
+	// the abandoned result is not cached
+	result, err := cachedFunc(t.Context(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, result)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCachedContextKeyFuncState_SingleflightPanicPropagatesToWaiters(t *testing.T) {
+	release := make(chan struct{})
+	fn := func(ctx context.Context, key int) (int, error) {
+		<-release
+		panic("boom")
+	}
+
+	cachedFunc := NewKeyFunc(fn).Build()
+
+	const waiters = 3
+	var wg sync.WaitGroup
+	panics := make([]any, waiters)
+	for i := range waiters {
+		wg.Go(func() {
+			defer func() { panics[i] = recover() }()
+			_, _ = cachedFunc(t.Context(), 1)
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range waiters {
+		assert.Equal(t, "boom", panics[i])
+	}
+}
+
 func TestCachedContextKeyFuncState_ConcurrentAccess(t *testing.T) {
 	callCounts := make(map[int]int)
 	callCountMutex := sync.Mutex{}
@@ -482,6 +666,146 @@ func TestCachedContextKeyFuncState_ErrorExpiresAndRefreshes(t *testing.T) {
 	assert.Equal(t, int32(2), callCount.Load())
 }
 
+func TestCachedContextKeyFuncState_ErrorTTLAndCacheErrorIf(t *testing.T) {
+	var callCount atomic.Int32
+	permanent := errors.New("not found")
+	transient := errors.New("timeout")
+	fn := func(ctx context.Context, key int) (string, error) {
+		callCount.Add(1)
+		if key == 1 {
+			return "", permanent
+		}
+		return "", transient
+	}
+
+	errorTTL := 20 * time.Millisecond
+	cachedFunc := NewKeyFunc(fn).
+		WithTTL(time.Hour).
+		WithErrorTTL(errorTTL).
+		WithCacheErrorIf(func(err error) bool { return errors.Is(err, permanent) }).
+		Build()
+	ctx := t.Context()
+
+	for range 3 {
+		_, err := cachedFunc(ctx, 1)
+		assert.ErrorIs(t, err, permanent)
+	}
+	assert.Equal(t, int32(1), callCount.Load())
+
+	for range 3 {
+		_, err := cachedFunc(ctx, 2)
+		assert.ErrorIs(t, err, transient)
+	}
+	assert.Equal(t, int32(4), callCount.Load(), "transient errors should not be cached")
+
+	time.Sleep(errorTTL + 10*time.Millisecond)
+	_, err := cachedFunc(ctx, 1)
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, int32(5), callCount.Load(), "cached error should expire after the error TTL")
+}
+
+func TestCachedContextKeyFuncState_StaleWhileRevalidate(t *testing.T) {
+	var callCount atomic.Int32
+	releaseRefresh := make(chan struct{})
+	fn := func(ctx context.Context, key int) (int, error) {
+		if n := callCount.Add(1); n > 2 {
+			<-releaseRefresh
+			return key * 100, nil
+		}
+		return key, nil
+	}
+
+	ttl := 20 * time.Millisecond
+	cachedFunc := NewKeyFunc(fn).WithTTL(ttl).WithStaleWhileRevalidate(time.Second).Build()
+	ctx := t.Context()
+
+	for key := 1; key <= 2; key++ {
+		result, err := cachedFunc(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, key, result)
+	}
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	for range 5 {
+		for key := 1; key <= 2; key++ {
+			result, err := cachedFunc(ctx, key)
+			assert.NoError(t, err)
+			assert.Equal(t, key, result)
+		}
+	}
+
+	close(releaseRefresh)
+	assert.Eventually(t, func() bool {
+		first, _ := cachedFunc(ctx, 1)
+		second, _ := cachedFunc(ctx, 2)
+		return first == 100 && second == 200
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(4), callCount.Load(), "each key should be refreshed once in the background")
+}
+
+func TestCachedContextKeyFuncState_StaleWhileRevalidateOutlivesCaller(t *testing.T) {
+	var callCount atomic.Int32
+	releaseRefresh := make(chan struct{})
+	fn := func(ctx context.Context, key int) (int, error) {
+		n := callCount.Add(1)
+		if n == 1 {
+			return 1, nil
+		}
+		select {
+		case <-releaseRefresh:
+			return int(n), nil
+		case <-ctx.Done():
+			return 0, context.Cause(ctx)
+		}
+	}
+
+	ttl := 20 * time.Millisecond
+	cachedFunc := NewKeyFunc(fn).WithTTL(ttl).WithStaleWhileRevalidate(time.Second).Build()
+
+	_, err := cachedFunc(t.Context(), 1)
+	require.NoError(t, err)
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	// like an HTTP handler, the caller's context ends once the stale value is served
+	ctx, cancel := context.WithCancel(t.Context())
+	result, err := cachedFunc(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+	cancel()
+
+	close(releaseRefresh)
+	assert.Eventually(t, func() bool {
+		result, _ := cachedFunc(t.Context(), 1)
+		return result == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), callCount.Load())
+}
+
+func TestCachedContextKeyFuncState_StaleWhileRevalidateAfterGrace(t *testing.T) {
+	var callCount atomic.Int32
+	fn := func(ctx context.Context, key int) (int32, error) {
+		return callCount.Add(1), nil
+	}
+
+	ttl := 10 * time.Millisecond
+	grace := 20 * time.Millisecond
+	cachedFunc := NewKeyFunc(fn).WithTTL(ttl).WithStaleWhileRevalidate(grace).Build()
+	ctx := t.Context()
+
+	result, err := cachedFunc(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), result)
+
+	time.Sleep(ttl + grace + 10*time.Millisecond)
+
+	// past the grace window the caller waits for a fresh value
+	result, err = cachedFunc(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), result)
+}
+
 func TestCachedContextKeyFuncState_ConcurrentAccessMultipleKeys(t *testing.T) {
 	callCounts := make(map[int]int)
 	callCountMutex := sync.Mutex{}
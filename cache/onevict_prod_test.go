@@ -0,0 +1,22 @@
+//go:build !debug
+
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithOnEvictRecoversPanic(t *testing.T) {
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithOnEvict(func(key string, value string, reason EvictReason) {
+		panic("boom")
+	}).BuildWithHandle()
+
+	_, _ = cachedFunc(t.Context(), "a")
+	assert.NotPanics(t, func() { handle.Invalidate("a") })
+	assert.Zero(t, handle.Stats().Size)
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StatsProvider is implemented by the cached function states and their handles.
+type StatsProvider interface {
+	Stats() Stats
+}
+
+var (
+	statsRegistryMu sync.RWMutex
+	statsRegistry   = make(map[string]StatsProvider)
+)
+
+// registerStats makes provider part of WritePrometheus under name, replacing
+// any cache previously registered with the same name. The registry holds on
+// to provider until the cache is closed, see FuncHandle.Close and
+// KeyFuncHandle.Close.
+func registerStats(name string, provider StatsProvider) {
+	statsRegistryMu.Lock()
+	defer statsRegistryMu.Unlock()
+	statsRegistry[name] = provider
+}
+
+// unregisterStats removes provider from the registry, unless another cache
+// has since been registered under name.
+func unregisterStats(name string, provider StatsProvider) {
+	statsRegistryMu.Lock()
+	defer statsRegistryMu.Unlock()
+	if statsRegistry[name] == provider {
+		delete(statsRegistry, name)
+	}
+}
+
+// RegisteredStats returns a snapshot of every named cache built with
+// BuildWithHandle, keyed by name.
+func RegisteredStats() map[string]Stats {
+	statsRegistryMu.RLock()
+	providers := make(map[string]StatsProvider, len(statsRegistry))
+	for name, provider := range statsRegistry {
+		providers[name] = provider
+	}
+	statsRegistryMu.RUnlock()
+
+	stats := make(map[string]Stats, len(providers))
+	for name, provider := range providers {
+		stats[name] = provider.Stats()
+	}
+	return stats
+}
+
+// WritePrometheus writes the stats of every registered cache in the
+// Prometheus text exposition format, one metric family per counter with the
+// cache name as the "cache" label.
+func WritePrometheus(w io.Writer) error {
+	return writePrometheus(w, RegisteredStats())
+}
+
+type prometheusFamily struct {
+	name  string
+	help  string
+	typ   string
+	value func(name string, stats Stats, bw *bufio.Writer)
+}
+
+var prometheusFamilies = []prometheusFamily{
+	{"cache_hits_total", "Calls served from the cache.", "counter", func(name string, stats Stats, bw *bufio.Writer) {
+		writeSample(bw, "cache_hits_total", name, "", "", float64(stats.Hits))
+	}},
+	{"cache_misses_total", "Calls that waited for a computation.", "counter", func(name string, stats Stats, bw *bufio.Writer) {
+		writeSample(bw, "cache_misses_total", name, "", "", float64(stats.Misses))
+	}},
+	{"cache_loads_total", "Executions of the cached function.", "counter", func(name string, stats Stats, bw *bufio.Writer) {
+		writeSample(bw, "cache_loads_total", name, "", "", float64(stats.Loads))
+	}},
+	{"cache_load_errors_total", "Executions of the cached function that returned an error.", "counter", func(name string, stats Stats, bw *bufio.Writer) {
+		writeSample(bw, "cache_load_errors_total", name, "", "", float64(stats.LoadErrors))
+	}},
+	{"cache_load_duration_seconds", "Duration of cached function executions.", "histogram", func(name string, stats Stats, bw *bufio.Writer) {
+		for _, bucket := range stats.LoadLatency.Buckets {
+			writeSample(bw, "cache_load_duration_seconds_bucket", name, "le", formatFloat(bucket.UpperBound.Seconds()), float64(bucket.Count))
+		}
+		writeSample(bw, "cache_load_duration_seconds_bucket", name, "le", "+Inf", float64(stats.LoadLatency.Count))
+		writeSample(bw, "cache_load_duration_seconds_sum", name, "", "", stats.LoadLatency.Sum.Seconds())
+		writeSample(bw, "cache_load_duration_seconds_count", name, "", "", float64(stats.LoadLatency.Count))
+	}},
+	{"cache_evictions_total", "Entries dropped from the cache by reason.", "counter", func(name string, stats Stats, bw *bufio.Writer) {
+		for reason := range numEvictReasons {
+			writeSample(bw, "cache_evictions_total", name, "reason", reason.String(), float64(stats.Evictions[reason]))
+		}
+	}},
+	{"cache_size", "Entries currently held by the cache.", "gauge", func(name string, stats Stats, bw *bufio.Writer) {
+		writeSample(bw, "cache_size", name, "", "", float64(stats.Size))
+	}},
+	{"cache_cost", "Total cost of the values held by the cache.", "gauge", func(name string, stats Stats, bw *bufio.Writer) {
+		writeSample(bw, "cache_cost", name, "", "", float64(stats.Cost))
+	}},
+}
+
+func writePrometheus(w io.Writer, stats map[string]Stats) error {
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	bw := bufio.NewWriter(w)
+	for _, family := range prometheusFamilies {
+		bw.WriteString("# HELP " + family.name + " " + family.help + "\n")
+		bw.WriteString("# TYPE " + family.name + " " + family.typ + "\n")
+		for _, name := range names {
+			family.value(name, stats[name], bw)
+		}
+	}
+	return bw.Flush()
+}
+
+func writeSample(bw *bufio.Writer, metric, cache, extraLabel, extraValue string, value float64) {
+	bw.WriteString(metric)
+	bw.WriteString(`{cache="`)
+	bw.WriteString(escapeLabelValue(cache))
+	if extraLabel != "" {
+		bw.WriteString(`",`)
+		bw.WriteString(extraLabel)
+		bw.WriteString(`="`)
+		bw.WriteString(escapeLabelValue(extraValue))
+	}
+	bw.WriteString(`"} `)
+	bw.WriteString(formatFloat(value))
+	bw.WriteByte('\n')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
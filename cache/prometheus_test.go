@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	stats := map[string]Stats{
+		"icons": {
+			Hits:      3,
+			Misses:    1,
+			Loads:     1,
+			Evictions: map[EvictReason]uint64{EvictReasonCapacity: 2},
+			Size:      5,
+			LoadLatency: LatencyHistogram{
+				Buckets: []HistogramBucket{{UpperBound: 5 * time.Millisecond, Count: 1}},
+				Count:   1,
+				Sum:     2 * time.Millisecond,
+			},
+		},
+		`we"ird`: {},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writePrometheus(&buf, stats))
+	out := buf.String()
+
+	for _, line := range []string{
+		"# TYPE cache_hits_total counter",
+		`cache_hits_total{cache="icons"} 3`,
+		`cache_misses_total{cache="icons"} 1`,
+		"# TYPE cache_load_duration_seconds histogram",
+		`cache_load_duration_seconds_bucket{cache="icons",le="0.005"} 1`,
+		`cache_load_duration_seconds_bucket{cache="icons",le="+Inf"} 1`,
+		`cache_load_duration_seconds_sum{cache="icons"} 0.002`,
+		`cache_evictions_total{cache="icons",reason="capacity"} 2`,
+		`cache_evictions_total{cache="icons",reason="expired"} 0`,
+		"# TYPE cache_size gauge",
+		`cache_size{cache="icons"} 5`,
+		`cache_size{cache="we\"ird"} 0`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+
+	// samples of one family are sorted by cache name
+	assert.Less(t, strings.Index(out, `cache_hits_total{cache="icons"}`), strings.Index(out, `cache_hits_total{cache="we\"ird"}`))
+}
+
+func TestWritePrometheusRegisteredCache(t *testing.T) {
+	cachedFunc, handle := NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	}).WithName("test_registered").BuildWithHandle()
+	_, _ = cachedFunc(t.Context(), "a")
+
+	assert.Equal(t, handle.Stats(), RegisteredStats()["test_registered"])
+
+	var buf bytes.Buffer
+	require.NoError(t, WritePrometheus(&buf))
+	assert.Contains(t, buf.String(), `cache_misses_total{cache="test_registered"} 1`+"\n")
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/goutils/task"
+)
+
+// minRefreshAheadRetry is the minimum time between two attempts of a failing
+// background refresh.
+const minRefreshAheadRetry = time.Second
+
+// refreshesAhead reports whether WithRefreshAhead is in effect.
+func (state *CachedFuncState[T]) refreshesAhead() bool {
+	return state.ttl > 0 && state.refreshAhead > 0 && state.refreshAhead < 1
+}
+
+// startRefreshAhead starts the refresh loop on a subtask of the configured
+// parent, or of the root task.
+func (state *CachedFuncState[T]) startRefreshAhead() {
+	name := "cache refresh-ahead"
+	if state.name != "" {
+		name += " " + state.name
+	}
+	var t *task.Task
+	if state.parent != nil {
+		t = state.parent.Subtask(name, true)
+	} else {
+		t = task.RootTask(name, true)
+	}
+	state.refreshTask = t
+	go state.refreshAheadLoop(t)
+}
+
+func (state *CachedFuncState[T]) refreshAheadLoop(t *task.Task) {
+	defer t.Finish(nil)
+
+	ctx := t.Context()
+	timer := state.clockOrReal().NewTimer(state.nextRefreshAhead())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+		}
+
+		// the value may have been refreshed by a caller or through the handle
+		delay := state.nextRefreshAhead()
+		if delay <= 0 {
+			if err := state.refreshAheadOnce(ctx); err != nil {
+				delay = state.refreshAheadRetry()
+			} else {
+				delay = state.nextRefreshAhead()
+			}
+		}
+		timer.Reset(delay)
+	}
+}
+
+// nextRefreshAhead returns how long until the cached value is due for a
+// refresh: once the configured fraction of its TTL has passed. A missing or
+// expired value is due right away.
+func (state *CachedFuncState[T]) nextRefreshAhead() time.Duration {
+	cached := state.cached.Load()
+	if cached == nil || cached.expireAt.IsZero() {
+		return 0
+	}
+	ttl := state.resultTTL(cached.err)
+	refreshAt := cached.expireAt.Add(-time.Duration(float64(ttl) * (1 - state.refreshAhead)))
+	return refreshAt.Sub(state.now())
+}
+
+// refreshAheadRetry returns how long to wait before retrying a failed
+// refresh: half of the refresh-ahead window, so a value is retried at least
+// once before it expires.
+func (state *CachedFuncState[T]) refreshAheadRetry() time.Duration {
+	return max(time.Duration(float64(state.ttl)*(1-state.refreshAhead)/2), minRefreshAheadRetry)
+}
+
+// refreshAheadOnce refreshes the cached value if it is still due. On failure
+// a valid cached value is kept and the error is reported; otherwise the
+// error is cached under the usual rules.
+func (state *CachedFuncState[T]) refreshAheadOnce(ctx context.Context) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.nextRefreshAhead() > 0 {
+		return nil
+	}
+
+	gen := state.currentGeneration()
+	result, err := state.execute(ctx)
+	if err == nil {
+		state.setResult(gen, result, nil)
+		return nil
+	}
+	if ctx.Err() != nil {
+		// the owning task is finishing
+		return err
+	}
+	if state.checkExpired() && state.shouldCache(ctx, err) {
+		state.setResult(gen, result, err)
+	}
+	state.notifyRefreshError(err)
+	return err
+}
+
+// notifyRefreshError invokes onRefreshError, or logs err without one. A
+// panic in onRefreshError is recovered and logged.
+func (state *CachedFuncState[T]) notifyRefreshError(err error) {
+	if state.onRefreshError == nil {
+		log.Err(err).Str("cache", state.name).Msg("cache: refresh-ahead failed")
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			log.Err(fmtCause(err)).Msg("cache: OnRefreshError panic")
+			panicWithDebugStack()
+		}
+	}()
+	state.onRefreshError(err)
+}
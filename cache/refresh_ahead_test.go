@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/task"
+)
+
+func TestWithRefreshAhead(t *testing.T) {
+	var calls atomic.Int32
+	cachedFunc, handle := NewFunc(func(ctx context.Context) (int32, error) {
+		return calls.Add(1), nil
+	}).WithTTL(200 * time.Millisecond).WithRefreshAhead(0.5).WithTask(task.GetTestTask(t)).BuildWithHandle()
+
+	// the first value is loaded without a caller
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	// and refreshed before it expires
+	require.Eventually(t, func() bool { return calls.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	result, err := cachedFunc(t.Context())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, result, int32(3))
+	assert.Zero(t, handle.Stats().Misses, "callers never wait for a load")
+}
+
+func TestWithRefreshAhead_KeepsValueOnError(t *testing.T) {
+	testErr := errors.New("test error")
+	var calls atomic.Int32
+	refreshErrs := make(chan error, 10)
+	_, handle := NewFunc(func(ctx context.Context) (string, error) {
+		if calls.Add(1) > 1 {
+			return "", testErr
+		}
+		return "good", nil
+	}).WithTTL(500 * time.Millisecond).WithRefreshAhead(0.5).WithTask(task.GetTestTask(t)).
+		WithOnRefreshError(func(err error) { refreshErrs <- err }).
+		BuildWithHandle()
+
+	select {
+	case err := <-refreshErrs:
+		require.ErrorIs(t, err, testErr)
+	case <-time.After(time.Second):
+		t.Fatal("refresh error not reported")
+	}
+	result, err, ok := handle.Peek()
+	assert.True(t, ok)
+	require.NoError(t, err)
+	assert.Equal(t, "good", result, "a failed refresh keeps the cached value")
+}
+
+func TestWithRefreshAhead_StopsWithTask(t *testing.T) {
+	parent := task.GetTestTask(t).Subtask("cache", true)
+	var calls atomic.Int32
+	NewFunc(func(ctx context.Context) (int32, error) {
+		return calls.Add(1), nil
+	}).WithTTL(20 * time.Millisecond).WithRefreshAhead(0.5).WithTask(parent).Build()
+
+	require.Eventually(t, func() bool { return calls.Load() >= 2 }, time.Second, 5*time.Millisecond)
+	parent.FinishAndWait(nil)
+
+	stoppedAt := calls.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stoppedAt, calls.Load(), "no refresh after the task finished")
+}
@@ -3,10 +3,159 @@ package cache
 import (
 	"context"
 	"errors"
+	"math/rand/v2"
 	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/yusing/goutils/mockable"
 )
 
-func waitForBackoff(ctx context.Context, delay time.Duration) error {
+// RetryAfterError is implemented by errors that tell when the failed call may
+// be retried, like an HTTP 429 or 503 response with a Retry-After header.
+// The retry loop waits for the hinted delay instead of its backoff delay.
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+// RetryAfter wraps err with a hint that the call should not be retried
+// before after has elapsed.
+func RetryAfter(err error, after time.Duration) error {
+	return &retryAfterError{err: err, after: after}
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+func (e *retryAfterError) RetryAfter() time.Duration {
+	return e.after
+}
+
+// retryAfterHint returns the positive delay hinted by err, if any error in
+// its tree implements RetryAfterError.
+func retryAfterHint(err error) (time.Duration, bool) {
+	var hinted RetryAfterError
+	if !errors.As(err, &hinted) {
+		return 0, false
+	}
+	after := hinted.RetryAfter()
+	return after, after > 0
+}
+
+// executeWithRetries calls fn, then retries it on error as configured: up to
+// cfg.retries more times, only for errors accepted by cfg.retryIf, waiting
+// for the backoff delay or the error's Retry-After hint between attempts,
+// and never past cfg.retryBudget.
+func executeWithRetries[T any](ctx context.Context, cfg *CachedFuncConfig, fn func(ctx context.Context) (T, error)) (result T, err error) {
+	clock := cfg.clockOrReal()
+	start := clock.Now()
+	result, err = fn(ctx)
+	if err == nil || cfg.retries == 0 {
+		return result, err
+	}
+
+	retryBackoff := cfg.newBackoff()
+	for retries := cfg.retries; retries > 0; retries-- {
+		if cause := context.Cause(ctx); cause != nil {
+			return result, cause
+		}
+		if cfg.retryIf != nil && !cfg.retryIf(err) {
+			return result, err
+		}
+		delay := retryBackoff.NextBackOff()
+		if delay == backoff.Stop {
+			return result, err
+		}
+		if after, ok := retryAfterHint(err); ok {
+			delay = after
+		}
+		if cfg.retryBudget > 0 && clock.Since(start)+delay > cfg.retryBudget {
+			// the next attempt would start past the budget
+			return result, err
+		}
+		if err := waitForBackoff(ctx, clock, delay); err != nil {
+			return result, err
+		}
+
+		result, err = fn(ctx)
+		if err == nil {
+			return result, nil
+		}
+	}
+	return result, err
+}
+
+func (cfg *CachedFuncConfig) newBackoff() backoff.BackOff {
+	if cfg.backoffFactory == nil {
+		return &backoff.ZeroBackOff{}
+	}
+	return cfg.backoffFactory()
+}
+
+// jitterBounds clamps the delays given to the jitter backoffs: negative
+// delays are treated as 0 and maxDelay is raised to at least base.
+func jitterBounds(base, maxDelay time.Duration) (time.Duration, time.Duration) {
+	base = max(base, 0)
+	return base, max(maxDelay, base)
+}
+
+// fullJitterBackOff waits a random delay between 0 and an exponentially
+// growing ceiling, capped at max.
+type fullJitterBackOff struct {
+	base, max time.Duration
+	attempt   int
+}
+
+func (b *fullJitterBackOff) NextBackOff() time.Duration {
+	ceiling := b.max
+	if b.attempt < 62 {
+		if exp := b.base << b.attempt; exp > 0 && exp < b.max {
+			ceiling = exp
+		}
+	}
+	b.attempt++
+	return rand.N(ceiling + 1)
+}
+
+func (b *fullJitterBackOff) Reset() {
+	b.attempt = 0
+}
+
+// decorrelatedJitterBackOff waits a random delay between base and three
+// times the previous delay, capped at max.
+type decorrelatedJitterBackOff struct {
+	base, max time.Duration
+	prev      time.Duration
+}
+
+func (b *decorrelatedJitterBackOff) NextBackOff() time.Duration {
+	upper := b.max
+	if prev := max(b.prev, b.base); prev < b.max/3 {
+		upper = prev * 3
+	}
+	next := b.base
+	if upper > b.base {
+		next += rand.N(upper - b.base + 1)
+	}
+	b.prev = next
+	return next
+}
+
+func (b *decorrelatedJitterBackOff) Reset() {
+	b.prev = 0
+}
+
+func waitForBackoff(ctx context.Context, clock mockable.Clock, delay time.Duration) error {
 	if err := context.Cause(ctx); err != nil {
 		return err
 	}
@@ -14,13 +163,13 @@ func waitForBackoff(ctx context.Context, delay time.Duration) error {
 		return nil
 	}
 
-	timer := time.NewTimer(delay)
+	timer := clock.NewTimer(delay)
 	defer timer.Stop()
 
 	select {
 	case <-ctx.Done():
 		return context.Cause(ctx)
-	case <-timer.C:
+	case <-timer.C():
 		return nil
 	}
 }
@@ -35,3 +184,21 @@ func shouldCacheResult(ctx context.Context, err error) bool {
 	}
 	return !errors.Is(err, cause)
 }
+
+// shouldCache extends shouldCacheResult with the WithCacheErrorIf predicate:
+// errors caused by the caller's context are never cached, and other errors
+// only when the predicate (if any) accepts them.
+func (cfg *CachedFuncConfig) shouldCache(ctx context.Context, err error) bool {
+	if !shouldCacheResult(ctx, err) {
+		return false
+	}
+	return err == nil || cfg.cacheErrorIf == nil || cfg.cacheErrorIf(err)
+}
+
+// resultTTL returns how long a result with the given error stays cached.
+func (cfg *CachedFuncConfig) resultTTL(err error) time.Duration {
+	if err != nil && cfg.errorTTL > 0 {
+		return cfg.errorTTL
+	}
+	return cfg.ttl
+}
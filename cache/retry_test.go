@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
 )
 
 func TestShouldCacheResult(t *testing.T) {
@@ -33,6 +36,49 @@ func TestShouldCacheResult(t *testing.T) {
 	}
 }
 
+func TestCachedFuncConfigShouldCache(t *testing.T) {
+	t.Parallel()
+
+	transient := errors.New("transient")
+	permanent := errors.New("permanent")
+	cfg := CachedFuncConfig{
+		cacheErrorIf: func(err error) bool { return errors.Is(err, permanent) },
+	}
+
+	if !cfg.shouldCache(t.Context(), nil) {
+		t.Fatal("success should be cached")
+	}
+	if cfg.shouldCache(t.Context(), transient) {
+		t.Fatal("error rejected by the predicate should not be cached")
+	}
+	if !cfg.shouldCache(t.Context(), permanent) {
+		t.Fatal("error accepted by the predicate should be cached")
+	}
+
+	canceledCtx, cancel := context.WithCancelCause(t.Context())
+	cancel(permanent)
+	if cfg.shouldCache(canceledCtx, permanent) {
+		t.Fatal("context cancellation cause should not be cached even if the predicate accepts it")
+	}
+}
+
+func TestCachedFuncConfigResultTTL(t *testing.T) {
+	t.Parallel()
+
+	cfg := CachedFuncConfig{ttl: time.Minute}
+	if got := cfg.resultTTL(errors.New("err")); got != time.Minute {
+		t.Fatalf("errors should use the TTL when no error TTL is set, got %v", got)
+	}
+
+	cfg.errorTTL = time.Second
+	if got := cfg.resultTTL(nil); got != time.Minute {
+		t.Fatalf("success should use the TTL, got %v", got)
+	}
+	if got := cfg.resultTTL(errors.New("err")); got != time.Second {
+		t.Fatalf("errors should use the error TTL, got %v", got)
+	}
+}
+
 func BenchmarkShouldCacheResult(b *testing.B) {
 	activeCtx := b.Context()
 	testErr := errors.New("test error")
@@ -67,3 +113,153 @@ func BenchmarkShouldCacheResult(b *testing.B) {
 		}
 	})
 }
+
+// countingFn fails with the given errors in order, then succeeds.
+func countingFn(errs ...error) (func(ctx context.Context) (int, error), *int) {
+	calls := 0
+	return func(ctx context.Context) (int, error) {
+		calls++
+		if calls <= len(errs) {
+			return 0, errs[calls-1]
+		}
+		return calls, nil
+	}, &calls
+}
+
+func TestExecuteWithRetriesRetryIf(t *testing.T) {
+	t.Parallel()
+
+	transient := errors.New("transient")
+	permanent := errors.New("permanent")
+	cfg := CachedFuncConfig{
+		retries: 5,
+		retryIf: func(err error) bool { return errors.Is(err, transient) },
+	}
+
+	fn, calls := countingFn(transient, transient)
+	result, err := executeWithRetries(t.Context(), &cfg, fn)
+	if err != nil || result != 3 {
+		t.Fatalf("expected transient errors to be retried, got %d, %v", result, err)
+	}
+
+	fn, calls = countingFn(transient, permanent, transient)
+	_, err = executeWithRetries(t.Context(), &cfg, fn)
+	if !errors.Is(err, permanent) || *calls != 2 {
+		t.Fatalf("expected to stop at the permanent error after 2 calls, got %v after %d calls", err, *calls)
+	}
+}
+
+func TestExecuteWithRetriesRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	limited := errors.New("rate limited")
+	cfg := CachedFuncConfig{
+		retries: 1,
+		backoffFactory: func() backoff.BackOff {
+			return backoff.NewConstantBackOff(time.Hour)
+		},
+	}
+
+	fn, _ := countingFn(RetryAfter(limited, 20*time.Millisecond))
+	start := time.Now()
+	result, err := executeWithRetries(t.Context(), &cfg, fn)
+	if err != nil || result != 2 {
+		t.Fatalf("expected the retry to succeed, got %d, %v", result, err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("expected to wait for the hinted 20ms instead of the backoff, waited %v", elapsed)
+	}
+
+	wrapped := RetryAfter(limited, time.Second)
+	if !errors.Is(wrapped, limited) || wrapped.Error() != limited.Error() {
+		t.Fatal("RetryAfter must wrap the original error")
+	}
+}
+
+func TestExecuteWithRetriesBudget(t *testing.T) {
+	t.Parallel()
+
+	transient := errors.New("transient")
+	cfg := CachedFuncConfig{
+		retries:     10,
+		retryBudget: 50 * time.Millisecond,
+		backoffFactory: func() backoff.BackOff {
+			return backoff.NewConstantBackOff(20 * time.Millisecond)
+		},
+	}
+
+	fn, calls := countingFn(transient, transient, transient, transient, transient)
+	start := time.Now()
+	_, err := executeWithRetries(t.Context(), &cfg, fn)
+	if !errors.Is(err, transient) || *calls != 3 {
+		t.Fatalf("expected to give up after 3 calls within the budget, got %v after %d calls", err, *calls)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("expected to stay within the 50ms budget, took %v", elapsed)
+	}
+
+	// a hint past the budget stops right away
+	fn, calls = countingFn(RetryAfter(transient, time.Minute))
+	_, err = executeWithRetries(t.Context(), &cfg, fn)
+	if !errors.Is(err, transient) || *calls != 1 {
+		t.Fatalf("expected not to retry past the budget, got %v after %d calls", err, *calls)
+	}
+}
+
+func TestFullJitterBackOff(t *testing.T) {
+	t.Parallel()
+
+	b := &fullJitterBackOff{base: 10 * time.Millisecond, max: 100 * time.Millisecond}
+	ceiling := 10 * time.Millisecond
+	for attempt := range 100 {
+		if delay := b.NextBackOff(); delay < 0 || delay > ceiling {
+			t.Fatalf("attempt %d: delay %v outside [0, %v]", attempt, delay, ceiling)
+		}
+		ceiling = min(2*ceiling, 100*time.Millisecond)
+	}
+	b.Reset()
+	if delay := b.NextBackOff(); delay > 10*time.Millisecond {
+		t.Fatalf("expected the ceiling to reset, got %v", delay)
+	}
+}
+
+func TestDecorrelatedJitterBackOff(t *testing.T) {
+	t.Parallel()
+
+	b := &decorrelatedJitterBackOff{base: 10 * time.Millisecond, max: 100 * time.Millisecond}
+	prev := 10 * time.Millisecond
+	for attempt := range 100 {
+		delay := b.NextBackOff()
+		if delay < 10*time.Millisecond || delay > min(3*prev, 100*time.Millisecond) {
+			t.Fatalf("attempt %d: delay %v outside [10ms, min(3*%v, 100ms)]", attempt, delay, prev)
+		}
+		prev = delay
+	}
+	b.Reset()
+	if delay := b.NextBackOff(); delay > 30*time.Millisecond {
+		t.Fatalf("expected the previous delay to reset, got %v", delay)
+	}
+}
+
+func TestJitterBackOffBounds(t *testing.T) {
+	t.Parallel()
+
+	fn := func(ctx context.Context) (int, error) { return 0, nil }
+	tests := []struct {
+		name               string
+		backoff            backoff.BackOff
+		minDelay, maxDelay time.Duration
+	}{
+		{"full max below base", NewFunc(fn).WithRetriesFullJitterBackoff(1, 10*time.Millisecond, -time.Second).backoffFactory(), 0, 10 * time.Millisecond},
+		{"full negative", NewFunc(fn).WithRetriesFullJitterBackoff(1, -time.Second, -time.Second).backoffFactory(), 0, 0},
+		{"decorrelated max below base", NewFunc(fn).WithRetriesDecorrelatedJitterBackoff(1, 10*time.Millisecond, 5*time.Millisecond).backoffFactory(), 10 * time.Millisecond, 10 * time.Millisecond},
+		{"decorrelated negative", NewKeyFunc(func(ctx context.Context, key int) (int, error) { return 0, nil }).WithRetriesDecorrelatedJitterBackoff(1, -time.Second, -time.Second).backoffFactory(), 0, 0},
+	}
+	for _, tt := range tests {
+		for range 10 {
+			if delay := tt.backoff.NextBackOff(); delay < tt.minDelay || delay > tt.maxDelay {
+				t.Fatalf("%s: delay %v outside [%v, %v]", tt.name, delay, tt.minDelay, tt.maxDelay)
+			}
+		}
+	}
+}
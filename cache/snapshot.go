@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// SnapshotCodec encodes and decodes the snapshots written by
+// KeyFuncHandle.Snapshot.
+type SnapshotCodec interface {
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// JSONSnapshotCodec is the default SnapshotCodec, backed by the strutils
+// JSON codec.
+var JSONSnapshotCodec SnapshotCodec = jsonSnapshotCodec{}
+
+type jsonSnapshotCodec struct{}
+
+func (jsonSnapshotCodec) Encode(w io.Writer, v any) error {
+	return strutils.NewJSONEncoder(w).Encode(v)
+}
+
+func (jsonSnapshotCodec) Decode(r io.Reader, v any) error {
+	return strutils.NewJSONDecoder(r).Decode(v)
+}
+
+const snapshotVersion = 1
+
+var ErrSnapshotVersion = errors.New("unsupported cache snapshot version")
+
+type snapshot[T any, K comparable] struct {
+	Version int                   `json:"version"`
+	Entries []snapshotEntry[T, K] `json:"entries"`
+}
+
+type snapshotEntry[T any, K comparable] struct {
+	Key   K `json:"key"`
+	Value T `json:"value"`
+	// zero when the value never expires
+	ExpireAt time.Time `json:"expire_at,omitzero"`
+}
+
+// Snapshot writes every servable cached value to w, with its expiry time, so
+// Restore can warm up another cache with it. Cached errors are skipped.
+func (h *KeyFuncHandle[T, K]) Snapshot(w io.Writer) error {
+	state := h.state
+	snap := snapshot[T, K]{Version: snapshotVersion}
+	for key, entry := range state.entries.Range {
+		cached := entry.cached.Load()
+		if cached == nil || cached.err != nil {
+			continue
+		}
+		if state.checkExpired(cached) && !cached.servableStale(&state.CachedFuncConfig) {
+			continue
+		}
+		snap.Entries = append(snap.Entries, snapshotEntry[T, K]{
+			Key:      key,
+			Value:    cached.result,
+			ExpireAt: cached.expireAt,
+		})
+	}
+	return state.snapshotCodec().Encode(w, snap)
+}
+
+// Restore reads a snapshot written by Snapshot and caches its values until
+// their original expiry time. Values that can no longer be served and keys
+// that already hold a value are skipped.
+func (h *KeyFuncHandle[T, K]) Restore(r io.Reader) error {
+	state := h.state
+	var snap snapshot[T, K]
+	if err := state.snapshotCodec().Decode(r, &snap); err != nil {
+		return err
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("%w: %d", ErrSnapshotVersion, snap.Version)
+	}
+
+	for _, e := range snap.Entries {
+		cached := &cachedValue[T]{result: e.Value, expireAt: e.ExpireAt}
+		if state.ttl > 0 && e.ExpireAt.IsZero() {
+			// saved without a TTL: start a fresh one rather than keeping it forever
+			cached.expireAt = state.now().Add(state.ttl)
+		}
+		if state.checkExpired(cached) && !cached.servableStale(&state.CachedFuncConfig) {
+			continue
+		}
+
+		entry, loaded := state.entries.LoadOrCompute(e.Key, newCacheEntry[T])
+		entry.refreshMu.Lock()
+		if entry.cached.Load() == nil {
+			state.storeValue(e.Key, entry, cached)
+		}
+		entry.refreshMu.Unlock()
+		state.trackEntry(e.Key, entry, loaded)
+	}
+	return nil
+}
+
+func (state *CachedContextKeyFuncState[T, K]) snapshotCodec() SnapshotCodec {
+	if state.codec == nil {
+		return JSONSnapshotCodec
+	}
+	return state.codec
+}
+
+// snapshotToFile writes a snapshot to path through a temporary file, so a
+// crash never leaves a truncated snapshot behind.
+func (h *KeyFuncHandle[T, K]) snapshotToFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := h.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// restoreFromFile restores the snapshot at path. A missing file is not an
+// error.
+func (h *KeyFuncHandle[T, K]) restoreFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return h.Restore(f)
+}
+
+// loadSnapshotFile is restoreFromFile for WithSnapshotFile, which logs
+// errors as there is no caller to return them to.
+func (h *KeyFuncHandle[T, K]) loadSnapshotFile(path string) {
+	if err := h.restoreFromFile(path); err != nil {
+		log.Err(err).Str("path", path).Msg("cache: failed to restore snapshot")
+	}
+}
+
+// saveSnapshotFile is snapshotToFile for WithSnapshotFile.
+func (h *KeyFuncHandle[T, K]) saveSnapshotFile(path string) {
+	if err := h.snapshotToFile(path); err != nil {
+		log.Err(err).Str("path", path).Msg("cache: failed to save snapshot")
+	}
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/task"
+)
+
+func newSnapshotTestFunc(ttl time.Duration) CachedKeyFuncBuilder[string, string] {
+	return NewKeyFunc(func(ctx context.Context, key string) (string, error) {
+		if key == "err" {
+			return "", errors.New("boom")
+		}
+		return "v-" + key, nil
+	}).WithTTL(ttl)
+}
+
+func TestKeyFuncHandle_SnapshotRestore(t *testing.T) {
+	ctx := t.Context()
+	cachedFunc, handle := newSnapshotTestFunc(time.Hour).BuildWithHandle()
+	_, _ = cachedFunc(ctx, "a")
+	_, _ = cachedFunc(ctx, "b")
+	_, _ = cachedFunc(ctx, "err")
+	handle.Set("expired", "gone")
+	expired, _ := handle.state.entries.Load("expired")
+	expired.cached.Store(&cachedValue[string]{result: "gone", expireAt: time.Now().Add(-time.Second)})
+	entryA, _ := handle.state.entries.Load("a")
+	wantExpiry := entryA.cached.Load().expireAt
+
+	var buf bytes.Buffer
+	require.NoError(t, handle.Snapshot(&buf))
+
+	_, restored := newSnapshotTestFunc(time.Hour).BuildWithHandle()
+	restored.Set("b", "newer")
+	require.NoError(t, restored.Restore(&buf))
+
+	keys := slices.Sorted(restored.Keys())
+	assert.Equal(t, []string{"a", "b"}, keys, "errors and expired values are skipped")
+
+	result, _, ok := restored.Peek("a")
+	assert.True(t, ok)
+	assert.Equal(t, "v-a", result)
+	entryA, _ = restored.state.entries.Load("a")
+	assert.True(t, wantExpiry.Equal(entryA.cached.Load().expireAt), "remaining TTL is kept")
+
+	result, _, _ = restored.Peek("b")
+	assert.Equal(t, "newer", result, "existing values are not overwritten")
+}
+
+func TestKeyFuncHandle_RestoreExpired(t *testing.T) {
+	cachedFunc, handle := newSnapshotTestFunc(20 * time.Millisecond).BuildWithHandle()
+	_, _ = cachedFunc(t.Context(), "a")
+
+	var buf bytes.Buffer
+	require.NoError(t, handle.Snapshot(&buf))
+	time.Sleep(30 * time.Millisecond)
+
+	_, restored := newSnapshotTestFunc(20 * time.Millisecond).BuildWithHandle()
+	require.NoError(t, restored.Restore(&buf))
+	assert.Zero(t, restored.Stats().Size, "values that expired since the snapshot are skipped")
+
+	// within the stale grace window they can still be served
+	buf.Reset()
+	_, _ = cachedFunc(t.Context(), "a")
+	require.NoError(t, handle.Snapshot(&buf))
+	time.Sleep(30 * time.Millisecond)
+
+	_, restored = newSnapshotTestFunc(20 * time.Millisecond).WithStaleWhileRevalidate(time.Hour).BuildWithHandle()
+	require.NoError(t, restored.Restore(&buf))
+	assert.Equal(t, 1, restored.Stats().Size)
+}
+
+func TestKeyFuncHandle_RestoreVersion(t *testing.T) {
+	_, handle := newSnapshotTestFunc(0).BuildWithHandle()
+	err := handle.Restore(bytes.NewBufferString(`{"version":99,"entries":[]}`))
+	assert.ErrorIs(t, err, ErrSnapshotVersion)
+}
+
+type gobSnapshotCodec struct{}
+
+func (gobSnapshotCodec) Encode(w io.Writer, v any) error { return gob.NewEncoder(w).Encode(v) }
+func (gobSnapshotCodec) Decode(r io.Reader, v any) error { return gob.NewDecoder(r).Decode(v) }
+
+func TestWithSnapshotCodec(t *testing.T) {
+	cachedFunc, handle := newSnapshotTestFunc(0).WithSnapshotCodec(gobSnapshotCodec{}).BuildWithHandle()
+	_, _ = cachedFunc(t.Context(), "a")
+
+	var buf bytes.Buffer
+	require.NoError(t, handle.Snapshot(&buf))
+
+	_, restored := newSnapshotTestFunc(0).WithSnapshotCodec(gobSnapshotCodec{}).BuildWithHandle()
+	require.NoError(t, restored.Restore(&buf))
+	result, _, ok := restored.Peek("a")
+	assert.True(t, ok)
+	assert.Equal(t, "v-a", result)
+}
+
+func TestWithSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	// a missing file is fine, and the snapshot is saved when the task is canceled
+	parent := task.GetTestTask(t).Subtask("cache", true)
+	cachedFunc, _ := newSnapshotTestFunc(time.Hour).WithSnapshotFile(path).WithTask(parent).BuildWithHandle()
+	_, _ = cachedFunc(t.Context(), "a")
+	parent.FinishAndWait(nil)
+
+	require.Eventually(t, func() bool {
+		_, handle := newSnapshotTestFunc(time.Hour).BuildWithHandle()
+		return handle.restoreFromFile(path) == nil && handle.Stats().Size == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// and restored on build
+	_, handle := newSnapshotTestFunc(time.Hour).WithSnapshotFile(path).BuildWithHandle()
+	result, _, ok := handle.Peek("a")
+	assert.True(t, ok)
+	assert.Equal(t, "v-a", result)
+}
@@ -6,7 +6,8 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/cenkalti/backoff/v5"
+	"github.com/yusing/goutils/mockable"
+	"github.com/yusing/goutils/task"
 )
 
 type cachedValue[T any] struct {
@@ -17,83 +18,182 @@ type cachedValue[T any] struct {
 
 const singleValueCacheKey = "<func>"
 
+func newCachedValue[T any](result T, err error, ttl time.Duration, now time.Time) *cachedValue[T] {
+	cached := &cachedValue[T]{
+		result: result,
+		err:    err,
+	}
+	if ttl > 0 {
+		cached.expireAt = now.Add(ttl)
+	}
+	return cached
+}
+
+// expired reports whether cached must be recomputed. Without a TTL values never
+// expire, but cached errors still do when an error TTL is configured.
+func (cached *cachedValue[T]) expired(cfg *CachedFuncConfig) bool {
+	if cached == nil {
+		return true
+	}
+	if cfg.entryTTL {
+		return !cached.expireAt.IsZero() && cfg.now().After(cached.expireAt)
+	}
+	if cfg.ttl == 0 && (cached.err == nil || cfg.errorTTL == 0) {
+		return false
+	}
+	return cfg.now().After(cached.expireAt)
+}
+
+// servableStale reports whether an expired value may still be returned while
+// it is being revalidated in the background. Cached errors are never served
+// stale.
+func (cached *cachedValue[T]) servableStale(cfg *CachedFuncConfig) bool {
+	if cached == nil || cached.err != nil || cfg.staleGrace <= 0 || cached.expireAt.IsZero() {
+		return false
+	}
+	return cfg.now().Before(cached.expireAt.Add(cfg.staleGrace))
+}
+
+// revalidateTimeout bounds a background stale-while-revalidate refresh.
+const revalidateTimeout = time.Minute
+
+// revalidateContext returns the context of a background refresh started by a
+// caller with ctx. It keeps the values of ctx but not its cancellation, since
+// HTTP handlers cancel theirs as soon as the stale value is served. It is
+// canceled instead after revalidateTimeout, or once owner, or the root task
+// if owner is nil, is canceled. stop must be called once the refresh is done.
+func revalidateContext(ctx context.Context, owner task.Parent) (_ context.Context, stop context.CancelFunc) {
+	ownerCtx := task.RootContext()
+	if owner != nil {
+		ownerCtx = owner.Context()
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), revalidateTimeout)
+	stopAfter := context.AfterFunc(ownerCtx, cancel)
+	return ctx, func() {
+		stopAfter()
+		cancel()
+	}
+}
+
+// clockOrReal returns the clock set with WithClock, or the real clock.
+func (cfg *CachedFuncConfig) clockOrReal() mockable.Clock {
+	return mockable.ClockOrReal(cfg.clock)
+}
+
+func (cfg *CachedFuncConfig) now() time.Time {
+	return cfg.clockOrReal().Now()
+}
+
 type CachedFuncState[T any] struct {
 	CachedFuncBuilder[T]
 
 	mu sync.Mutex
 
-	cached atomic.Pointer[cachedValue[T]]
+	// runs the WithRefreshAhead loop, if any
+	refreshTask *task.Task
+
+	cached       atomic.Pointer[cachedValue[T]]
+	revalidating atomic.Bool
+
+	// guards generation and the updates of cached
+	resultMu sync.Mutex
+	// bumped by Invalidate, Set and Close, so a computation that started
+	// before them does not cache its result
+	generation uint64
+
+	stats cacheStats
 }
 
 func (state *CachedFuncState[T]) cachedExpired(cached *cachedValue[T]) bool {
-	if cached == nil {
-		return true
-	}
-	if state.ttl == 0 {
-		return false
-	}
-	return time.Now().After(cached.expireAt)
+	return cached.expired(&state.CachedFuncConfig)
 }
 
 func (state *CachedFuncState[T]) checkExpired() bool {
 	return state.cachedExpired(state.cached.Load())
 }
 
-func (state *CachedFuncState[T]) setResult(result T, err error) {
-	cached := &cachedValue[T]{
-		result: result,
-		err:    err,
-	}
-	if state.ttl > 0 {
-		cached.expireAt = time.Now().Add(state.ttl)
-	}
-	state.cached.Store(cached)
+// currentGeneration returns the generation to give setResult for a
+// computation starting now.
+func (state *CachedFuncState[T]) currentGeneration() uint64 {
+	state.resultMu.Lock()
+	defer state.resultMu.Unlock()
+	return state.generation
 }
 
-func (state *CachedFuncState[T]) newBackoff() backoff.BackOff {
-	if state.backoffFactory == nil {
-		return &backoff.ZeroBackOff{}
+// setResult caches the result of a computation that started at generation
+// gen, unless the value was invalidated or set since.
+func (state *CachedFuncState[T]) setResult(gen uint64, result T, err error) {
+	state.resultMu.Lock()
+	defer state.resultMu.Unlock()
+	if state.generation == gen {
+		state.storeResult(result, err)
 	}
-	return state.backoffFactory()
 }
 
-func (state *CachedFuncState[T]) execute(ctx context.Context) (T, error) {
-	result, err := state.fn(ctx)
-	if err == nil || state.retries == 0 {
-		return result, err
+// set caches value, discarding the computations in flight.
+func (state *CachedFuncState[T]) set(value T) {
+	state.resultMu.Lock()
+	defer state.resultMu.Unlock()
+	state.generation++
+	state.storeResult(value, nil)
+}
+
+// invalidate drops the cached value, discarding the computations in flight.
+func (state *CachedFuncState[T]) invalidate() {
+	state.resultMu.Lock()
+	defer state.resultMu.Unlock()
+	state.generation++
+	if state.cached.Swap(nil) != nil {
+		state.stats.evicted(EvictReasonInvalidated)
 	}
+}
 
-	retries := state.retries
-	retryBackoff := state.newBackoff()
+// storeResult publishes a new cached value. The caller must hold resultMu.
+func (state *CachedFuncState[T]) storeResult(result T, err error) {
+	old := state.cached.Swap(newCachedValue(result, err, state.resultTTL(err), state.now()))
+	if old != nil && !state.cachedExpired(old) {
+		state.stats.evicted(EvictReasonReplaced)
+	}
+}
 
-	for retries > 0 {
-		select {
-		case <-ctx.Done():
-			return result, context.Cause(ctx)
-		default:
-			retries--
-			delay := retryBackoff.NextBackOff()
-			if delay == backoff.Stop {
-				return result, err
-			}
-			if err := waitForBackoff(ctx, delay); err != nil {
-				return result, err
-			}
+// Stats returns a snapshot of the state's counters.
+func (state *CachedFuncState[T]) Stats() Stats {
+	size := 0
+	if state.cached.Load() != nil {
+		size = 1
+	}
+	return state.stats.snapshot(size)
+}
 
-			result, err = state.fn(ctx)
-			if err == nil {
-				return result, nil
-			}
-		}
+// close unregisters provider from the stats registry, stops the refresh-ahead
+// loop and drops the cached value.
+func (state *CachedFuncState[T]) close(provider StatsProvider) {
+	if state.name != "" {
+		unregisterStats(state.name, provider)
+	}
+	if state.refreshTask != nil {
+		state.refreshTask.Finish(nil)
 	}
+	state.invalidate()
+}
 
-	return result, err
+func (state *CachedFuncState[T]) execute(ctx context.Context) (result T, err error) {
+	start := time.Now()
+	defer func() { state.stats.recordLoad(start, err) }()
+
+	return executeWithRetries(ctx, &state.CachedFuncConfig, state.fn)
 }
 
 func (state *CachedFuncState[T]) callContext(ctx context.Context) (T, error) {
 	if cached := state.cached.Load(); !state.cachedExpired(cached) {
+		state.stats.hit()
 		logCacheHit(singleValueCacheKey, cached.result, cached.err)
 		return cached.result, cached.err
+	} else if cached.servableStale(&state.CachedFuncConfig) {
+		state.stats.hit()
+		logCacheStaleHit(singleValueCacheKey, cached.result)
+		state.revalidate(ctx)
+		return cached.result, nil
 	}
 
 	state.mu.Lock()
@@ -101,20 +201,53 @@ func (state *CachedFuncState[T]) callContext(ctx context.Context) (T, error) {
 
 	cached := state.cached.Load()
 	if !state.cachedExpired(cached) {
+		state.stats.hit()
 		logCacheHit(singleValueCacheKey, cached.result, cached.err)
 		return cached.result, cached.err
 	}
+	state.stats.miss()
 	if cached != nil {
+		state.stats.evicted(EvictReasonExpired)
 		logCacheExpiredEntry(singleValueCacheKey, cached.result, cached.err)
 	} else {
 		logCacheMiss(singleValueCacheKey)
 		logCacheUsage(1, 1)
 	}
 
+	gen := state.currentGeneration()
 	result, err := state.execute(ctx)
-	if shouldCacheResult(ctx, err) {
-		state.setResult(result, err)
+	if state.shouldCache(ctx, err) {
+		state.setResult(gen, result, err)
 	}
 
 	return result, err
 }
+
+// revalidate refreshes the cached value in the background unless a refresh is
+// already running. The refresh outlives the caller's context, see
+// revalidateContext. A failed refresh keeps the stale value until the grace
+// window ends and the next caller refreshes in the foreground.
+func (state *CachedFuncState[T]) revalidate(ctx context.Context) {
+	if !state.revalidating.CompareAndSwap(false, true) {
+		return
+	}
+	ctx, stop := revalidateContext(ctx, state.parent)
+	go func() {
+		defer state.revalidating.Store(false)
+		defer stop()
+
+		state.mu.Lock()
+		defer state.mu.Unlock()
+
+		// a foreground refresh may have won the race after the grace window ended
+		if !state.checkExpired() {
+			return
+		}
+
+		gen := state.currentGeneration()
+		result, err := state.execute(ctx)
+		if err == nil {
+			state.setResult(gen, result, nil)
+		}
+	}()
+}
@@ -10,6 +10,9 @@ import (
 
 	"github.com/cenkalti/backoff/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/mockable"
+	"github.com/yusing/goutils/task"
 )
 
 func TestCachedFuncState_BasicCaching(t *testing.T) {
@@ -91,6 +94,27 @@ func TestCachedFuncState_WithTTL(t *testing.T) {
 	assert.Equal(t, 2, callCount)
 }
 
+func TestCachedFuncState_WithClock(t *testing.T) {
+	clock := mockable.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	callCount := 0
+	fn := func(ctx context.Context) (int, error) {
+		callCount++
+		return callCount, nil
+	}
+	cachedFunc := NewFunc(fn).WithTTL(time.Hour).WithClock(clock).Build()
+
+	result, _ := cachedFunc(t.Context())
+	assert.Equal(t, 1, result)
+
+	clock.Advance(time.Hour)
+	result, _ = cachedFunc(t.Context())
+	assert.Equal(t, 1, result, "not expired at exactly the TTL")
+
+	clock.Advance(time.Nanosecond)
+	result, _ = cachedFunc(t.Context())
+	assert.Equal(t, 2, result)
+}
+
 func TestCachedFuncState_WithZeroTTL(t *testing.T) {
 	callCount := 0
 	fn := func(ctx context.Context) (string, error) {
@@ -427,6 +451,229 @@ func TestCachedFuncState_ErrorExpiresAndRefreshes(t *testing.T) {
 	assert.Equal(t, int32(2), callCount.Load())
 }
 
+func TestCachedFuncState_ErrorTTL(t *testing.T) {
+	var callCount atomic.Int32
+	testErr := errors.New("temporary error")
+	fn := func(ctx context.Context) (string, error) {
+		if callCount.Add(1) == 1 {
+			return "", testErr
+		}
+		return "success", nil
+	}
+
+	errorTTL := 20 * time.Millisecond
+	cachedFunc := NewFunc(fn).WithTTL(time.Hour).WithErrorTTL(errorTTL).Build()
+
+	_, err := cachedFunc(t.Context())
+	assert.ErrorIs(t, err, testErr)
+	_, err = cachedFunc(t.Context())
+	assert.ErrorIs(t, err, testErr)
+	assert.Equal(t, int32(1), callCount.Load())
+
+	time.Sleep(errorTTL + 10*time.Millisecond)
+
+	result, err := cachedFunc(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, "success", result)
+
+	// the success keeps the regular TTL
+	time.Sleep(errorTTL + 10*time.Millisecond)
+	_, _ = cachedFunc(t.Context())
+	assert.Equal(t, int32(2), callCount.Load())
+}
+
+func TestCachedFuncState_ErrorTTLWithoutTTL(t *testing.T) {
+	var callCount atomic.Int32
+	testErr := errors.New("temporary error")
+	fn := func(ctx context.Context) (string, error) {
+		callCount.Add(1)
+		return "", testErr
+	}
+
+	errorTTL := 20 * time.Millisecond
+	cachedFunc := NewFunc(fn).WithErrorTTL(errorTTL).Build()
+
+	_, _ = cachedFunc(t.Context())
+	_, _ = cachedFunc(t.Context())
+	assert.Equal(t, int32(1), callCount.Load())
+
+	// without a TTL errors would be cached forever, the error TTL still applies
+	time.Sleep(errorTTL + 10*time.Millisecond)
+	_, _ = cachedFunc(t.Context())
+	assert.Equal(t, int32(2), callCount.Load())
+}
+
+func TestCachedFuncState_CacheErrorIf(t *testing.T) {
+	var callCount atomic.Int32
+	permanent := errors.New("not found")
+	transient := errors.New("timeout")
+	fn := func(ctx context.Context) (string, error) {
+		if callCount.Add(1) <= 2 {
+			return "", transient
+		}
+		return "", permanent
+	}
+
+	cachedFunc := NewFunc(fn).WithCacheErrorIf(func(err error) bool {
+		return errors.Is(err, permanent)
+	}).Build()
+
+	_, err := cachedFunc(t.Context())
+	assert.ErrorIs(t, err, transient)
+	_, err = cachedFunc(t.Context())
+	assert.ErrorIs(t, err, transient)
+	assert.Equal(t, int32(2), callCount.Load(), "transient errors should not be cached")
+
+	_, err = cachedFunc(t.Context())
+	assert.ErrorIs(t, err, permanent)
+	_, err = cachedFunc(t.Context())
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, int32(3), callCount.Load(), "permanent errors should be cached")
+}
+
+func TestCachedFuncState_StaleWhileRevalidate(t *testing.T) {
+	var callCount atomic.Int32
+	releaseRefresh := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		if n := callCount.Add(1); n > 1 {
+			<-releaseRefresh
+			return int(n), nil
+		}
+		return 1, nil
+	}
+
+	ttl := 20 * time.Millisecond
+	cachedFunc := NewFunc(fn).WithTTL(ttl).WithStaleWhileRevalidate(time.Second).Build()
+
+	result, err := cachedFunc(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	// every caller in the grace window gets the stale value without waiting
+	for range 10 {
+		result, err = cachedFunc(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result)
+	}
+
+	close(releaseRefresh)
+	assert.Eventually(t, func() bool {
+		result, _ := cachedFunc(t.Context())
+		return result == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), callCount.Load(), "only one background refresh should run")
+}
+
+func TestCachedFuncState_StaleWhileRevalidateKeepsStaleOnError(t *testing.T) {
+	var callCount atomic.Int32
+	testErr := errors.New("upstream down")
+	fn := func(ctx context.Context) (string, error) {
+		if callCount.Add(1) == 1 {
+			return "stale", nil
+		}
+		return "", testErr
+	}
+
+	ttl := 20 * time.Millisecond
+	grace := 100 * time.Millisecond
+	cachedFunc := NewFunc(fn).WithTTL(ttl).WithStaleWhileRevalidate(grace).Build()
+
+	_, err := cachedFunc(t.Context())
+	require.NoError(t, err)
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	result, err := cachedFunc(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, "stale", result)
+	assert.Eventually(t, func() bool { return callCount.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	result, err = cachedFunc(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, "stale", result, "failed background refresh must not replace the stale value")
+
+	// once the grace window is over, callers refresh in the foreground and see the error
+	time.Sleep(grace)
+	_, err = cachedFunc(t.Context())
+	assert.ErrorIs(t, err, testErr)
+}
+
+func TestCachedFuncState_StaleWhileRevalidateOutlivesCaller(t *testing.T) {
+	var callCount atomic.Int32
+	releaseRefresh := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		n := callCount.Add(1)
+		if n == 1 {
+			return 1, nil
+		}
+		select {
+		case <-releaseRefresh:
+			return int(n), nil
+		case <-ctx.Done():
+			return 0, context.Cause(ctx)
+		}
+	}
+
+	ttl := 20 * time.Millisecond
+	cachedFunc := NewFunc(fn).WithTTL(ttl).WithStaleWhileRevalidate(time.Second).Build()
+
+	_, err := cachedFunc(t.Context())
+	require.NoError(t, err)
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	// like an HTTP handler, the caller's context ends once the stale value is served
+	ctx, cancel := context.WithCancel(t.Context())
+	result, err := cachedFunc(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+	cancel()
+
+	close(releaseRefresh)
+	assert.Eventually(t, func() bool {
+		result, _ := cachedFunc(t.Context())
+		return result == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), callCount.Load())
+}
+
+func TestCachedFuncState_StaleWhileRevalidateStopsWithTask(t *testing.T) {
+	var callCount atomic.Int32
+	refreshErr := make(chan error, 1)
+	fn := func(ctx context.Context) (int, error) {
+		if callCount.Add(1) == 1 {
+			return 1, nil
+		}
+		<-ctx.Done()
+		refreshErr <- context.Cause(ctx)
+		return 0, context.Cause(ctx)
+	}
+
+	parent := task.GetTestTask(t).Subtask("cache", true)
+	ttl := 20 * time.Millisecond
+	cachedFunc := NewFunc(fn).WithTTL(ttl).WithStaleWhileRevalidate(time.Second).WithTask(parent).Build()
+
+	_, err := cachedFunc(t.Context())
+	require.NoError(t, err)
+
+	time.Sleep(ttl + 10*time.Millisecond)
+
+	result, err := cachedFunc(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result)
+	assert.Eventually(t, func() bool { return callCount.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	parent.Finish(nil)
+	select {
+	case err := <-refreshErr:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("background refresh did not stop with its task")
+	}
+}
+
 func TestCachedFuncState_DifferentTypes(t *testing.T) {
 	// Test with int
 	intFn := func(ctx context.Context) (int, error) {
@@ -504,7 +751,7 @@ func TestCachedFuncState_ExpirationLogic(t *testing.T) {
 	assert.True(t, state.checkExpired())
 
 	// Test checkExpired after setting result
-	state.setResult("test", nil)
+	state.set("test")
 	assert.False(t, state.checkExpired())
 
 	// Test checkExpired after TTL expires
@@ -515,7 +762,7 @@ func TestCachedFuncState_ExpirationLogic(t *testing.T) {
 	stateZeroTTL := &CachedFuncState[string]{
 		fn: fn,
 	}
-	stateZeroTTL.setResult("test", nil)
+	stateZeroTTL.set("test")
 	assert.False(t, stateZeroTTL.checkExpired())
 	time.Sleep(50 * time.Millisecond)
 	assert.False(t, stateZeroTTL.checkExpired()) // Should still be false with TTL=0
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EvictReason describes why a cached entry was dropped.
+type EvictReason uint8
+
+const (
+	// EvictReasonExpired means the entry outlived its TTL and was recomputed.
+	EvictReasonExpired EvictReason = iota
+	// EvictReasonCapacity means the entry was trimmed to respect WithMaxEntries
+	// or WithMaxCost.
+	EvictReasonCapacity
+	// EvictReasonInvalidated means the entry was dropped through a handle.
+	EvictReasonInvalidated
+	// EvictReasonReplaced means a still valid value was overwritten by Set or
+	// Refresh.
+	EvictReasonReplaced
+
+	numEvictReasons
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictReasonExpired:
+		return "expired"
+	case EvictReasonCapacity:
+		return "capacity"
+	case EvictReasonInvalidated:
+		return "invalidated"
+	case EvictReasonReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r EvictReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// loadLatencyBuckets are the upper bounds of the load latency histogram.
+var loadLatencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Stats is a point-in-time snapshot of a cache's counters.
+type Stats struct {
+	// Hits counts calls served from the cache, including stale hits.
+	Hits uint64 `json:"hits"`
+	// Misses counts calls that had to wait for a computation.
+	Misses uint64 `json:"misses"`
+	// Loads counts computations of the cached value. Retries within one
+	// computation are not counted separately.
+	Loads uint64 `json:"loads"`
+	// LoadErrors counts loads that returned an error.
+	LoadErrors uint64 `json:"load_errors"`
+	// LoadLatency is the distribution of load durations.
+	LoadLatency LatencyHistogram `json:"load_latency"`
+	// Evictions counts dropped entries by reason.
+	Evictions map[EvictReason]uint64 `json:"evictions"`
+	// Size is the number of entries currently held.
+	Size int `json:"size"`
+	// Cost is the total cost of the cached values, see WithMaxCost.
+	Cost int64 `json:"cost"`
+}
+
+// LatencyHistogram is a cumulative histogram, as in Prometheus: each bucket
+// counts the observations less than or equal to its upper bound, and Count
+// doubles as the +Inf bucket.
+type LatencyHistogram struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   uint64            `json:"count"`
+	Sum     time.Duration     `json:"sum"`
+}
+
+type HistogramBucket struct {
+	UpperBound time.Duration `json:"le"`
+	Count      uint64        `json:"count"`
+}
+
+// HitRatio returns the fraction of calls served from the cache.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// cacheStats holds the always-on counters of a cache. Every field is updated
+// with a single atomic add, so recording never takes a lock.
+type cacheStats struct {
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+	loadErrors atomic.Uint64
+	evictions  [numEvictReasons]atomic.Uint64
+
+	// one counter per bucket plus +Inf, not cumulative
+	loadBuckets [len(loadLatencyBuckets) + 1]atomic.Uint64
+	loadNanos   atomic.Int64
+}
+
+func (s *cacheStats) hit() {
+	s.hits.Add(1)
+}
+
+func (s *cacheStats) miss() {
+	s.misses.Add(1)
+}
+
+func (s *cacheStats) evicted(reason EvictReason) {
+	s.evictions[reason].Add(1)
+}
+
+func (s *cacheStats) recordLoad(start time.Time, err error) {
+	elapsed := time.Since(start)
+	if err != nil {
+		s.loadErrors.Add(1)
+	}
+	s.loadNanos.Add(int64(elapsed))
+	i := 0
+	for i < len(loadLatencyBuckets) && elapsed > loadLatencyBuckets[i] {
+		i++
+	}
+	s.loadBuckets[i].Add(1)
+}
+
+func (s *cacheStats) snapshot(size int) Stats {
+	stats := Stats{
+		Hits:       s.hits.Load(),
+		Misses:     s.misses.Load(),
+		LoadErrors: s.loadErrors.Load(),
+		Evictions:  make(map[EvictReason]uint64, numEvictReasons),
+		Size:       size,
+	}
+	for reason := range numEvictReasons {
+		stats.Evictions[reason] = s.evictions[reason].Load()
+	}
+
+	stats.LoadLatency.Buckets = make([]HistogramBucket, len(loadLatencyBuckets))
+	var cumulative uint64
+	for i, bound := range loadLatencyBuckets {
+		cumulative += s.loadBuckets[i].Load()
+		stats.LoadLatency.Buckets[i] = HistogramBucket{UpperBound: bound, Count: cumulative}
+	}
+	cumulative += s.loadBuckets[len(loadLatencyBuckets)].Load()
+	stats.LoadLatency.Count = cumulative
+	stats.LoadLatency.Sum = time.Duration(s.loadNanos.Load())
+	stats.Loads = cumulative
+	return stats
+}
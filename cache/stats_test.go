@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuncHandleStats(t *testing.T) {
+	testErr := errors.New("test error")
+	calls := 0
+	fn := func(ctx context.Context) (int, error) {
+		calls++
+		if calls == 1 {
+			return 0, testErr
+		}
+		return 42, nil
+	}
+
+	ttl := 20 * time.Millisecond
+	cachedFunc, handle := NewFunc(fn).WithTTL(ttl).BuildWithHandle()
+	ctx := t.Context()
+
+	assert.Zero(t, handle.Stats().Size)
+
+	_, _ = cachedFunc(ctx) // miss, load error
+	_, _ = cachedFunc(ctx) // hit
+	time.Sleep(ttl + 10*time.Millisecond)
+	_, _ = cachedFunc(ctx) // miss, expired
+	_, _ = cachedFunc(ctx) // hit
+
+	stats := handle.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(2), stats.Loads)
+	assert.Equal(t, uint64(1), stats.LoadErrors)
+	assert.Equal(t, uint64(1), stats.Evictions[EvictReasonExpired])
+	assert.Equal(t, uint64(0), stats.Evictions[EvictReasonCapacity])
+	assert.Equal(t, 1, stats.Size)
+	assert.Equal(t, uint64(2), stats.LoadLatency.Count)
+	assert.InDelta(t, 0.5, stats.HitRatio(), 0.001)
+}
+
+func TestKeyFuncHandleStats(t *testing.T) {
+	fn := func(ctx context.Context, key int) (int, error) {
+		return key, nil
+	}
+
+	cachedFunc, handle := NewKeyFunc(fn).WithMaxEntries(2).BuildWithHandle()
+	ctx := t.Context()
+
+	for key := range 3 {
+		_, _ = cachedFunc(ctx, key)
+		_, _ = cachedFunc(ctx, key)
+	}
+
+	stats := handle.Stats()
+	assert.Equal(t, uint64(3), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.Equal(t, uint64(3), stats.Loads)
+	assert.Zero(t, stats.LoadErrors)
+
+	handle.state.Cleanup()
+	stats = handle.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions[EvictReasonCapacity])
+	assert.Equal(t, 2, stats.Size)
+}
+
+func TestCacheStatsLoadLatencyBuckets(t *testing.T) {
+	var stats cacheStats
+	now := time.Now()
+	stats.recordLoad(now, nil)                               // <= 1ms
+	stats.recordLoad(now.Add(-30*time.Millisecond), nil)     // <= 50ms
+	stats.recordLoad(now.Add(-time.Minute), errors.New("x")) // +Inf
+
+	snapshot := stats.snapshot(0)
+	require.Len(t, snapshot.LoadLatency.Buckets, len(loadLatencyBuckets))
+	assert.Equal(t, uint64(3), snapshot.Loads)
+	assert.Equal(t, uint64(1), snapshot.LoadErrors)
+	assert.Equal(t, uint64(3), snapshot.LoadLatency.Count)
+	assert.GreaterOrEqual(t, snapshot.LoadLatency.Sum, time.Minute)
+
+	for _, bucket := range snapshot.LoadLatency.Buckets {
+		switch {
+		case bucket.UpperBound < 25*time.Millisecond:
+			assert.Equalf(t, uint64(1), bucket.Count, "le=%s", bucket.UpperBound)
+		case bucket.UpperBound >= 50*time.Millisecond:
+			assert.Equalf(t, uint64(2), bucket.Count, "le=%s", bucket.UpperBound)
+		}
+	}
+}
+
+func TestEvictReasonString(t *testing.T) {
+	assert.Equal(t, "expired", EvictReasonExpired.String())
+	assert.Equal(t, "capacity", EvictReasonCapacity.String())
+	assert.Equal(t, "unknown", numEvictReasons.String())
+}
@@ -0,0 +1,196 @@
+package gperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// codedError attaches a machine-readable code and an HTTP status to an
+// error, see WithCode.
+type codedError struct {
+	Err    Error
+	Code   string
+	Status int
+}
+
+var (
+	_ PlainError    = (*codedError)(nil)
+	_ MarkdownError = (*codedError)(nil)
+)
+
+// WithCode attaches a machine-readable code, such as "route_not_found", and
+// the HTTP status to answer with to err. The code survives Subject, With and
+// Wrap, and is found by Code and HTTPStatus when err is nested in other
+// errors.
+//
+// A zero httpStatus keeps the status of the code err already has, if any.
+func WithCode(err error, code string, httpStatus int) Error {
+	if err == nil {
+		return nil
+	}
+	if httpStatus == 0 {
+		if inner, ok := errors.AsType[*codedError](err); ok {
+			httpStatus = inner.Status
+		}
+	}
+	return &codedError{Err: wrap(err), Code: code, Status: httpStatus}
+}
+
+// Code returns the code of the first error in err's tree, depth-first, that
+// has one, or an empty string if none does.
+func Code(err error) string {
+	code, _ := CodeOf(err)
+	return code
+}
+
+// CodeOf returns the code and HTTP status attached with WithCode to the
+// first error in err's tree, depth-first, that has a code, or an empty code
+// and a zero status if none does.
+func CodeOf(err error) (code string, httpStatus int) {
+	if coded, ok := errors.AsType[*codedError](err); ok {
+		return coded.Code, coded.Status
+	}
+	return "", 0
+}
+
+// HTTPStatus returns the HTTP status of the first error in err's tree,
+// depth-first, that has a code, http.StatusInternalServerError if none does,
+// or http.StatusOK if err is nil.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if _, status := CodeOf(err); status != 0 {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func (err *codedError) Unwrap() error {
+	return err.Err
+}
+
+func (err *codedError) Is(other error) bool {
+	if other, ok := other.(*codedError); ok { //nolint:errorlint
+		return err.Code == other.Code && err.Err.Is(other.Err)
+	}
+	return err.Err.Is(other)
+}
+
+func (err *codedError) Subject(subject string) Error {
+	clone := *err
+	clone.Err = PrependSubject(err.Err, subject)
+	return &clone
+}
+
+func (err *codedError) Subjectf(format string, args ...any) Error {
+	if len(args) > 0 {
+		return err.Subject(fmt.Sprintf(format, args...))
+	}
+	return err.Subject(format)
+}
+
+func (err *codedError) With(extra error) Error {
+	clone := *err
+	clone.Err = err.Err.With(extra)
+	return &clone
+}
+
+func (err *codedError) Withf(format string, args ...any) Error {
+	clone := *err
+	clone.Err = err.Err.Withf(format, args...)
+	return &clone
+}
+
+func (err *codedError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *codedError) Plain() []byte {
+	return err.Err.Plain()
+}
+
+func (err *codedError) Markdown() []byte {
+	return err.Err.Markdown()
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (err *codedError) MarshalJSON() ([]byte, error) {
+	return strutils.MarshalJSON(struct {
+		Code   string `json:"code"`
+		Status int    `json:"status,omitempty"`
+		Err    Error  `json:"err"`
+	}{err.Code, err.Status, err.Err})
+}
+
+// Detail is a structured view of an error tree, see Details.
+type Detail struct {
+	// Subjects are the subjects of the error, outermost first.
+	Subjects []string `json:"subjects,omitempty"`
+	// Message is the plain error message without its subjects. It is empty
+	// for a group of errors without a message of its own.
+	Message  string    `json:"message"`
+	Code     string    `json:"code,omitempty"`
+	Status   int       `json:"status,omitempty"`
+	Children []*Detail `json:"children,omitempty"`
+} // @name ErrorDetail
+
+// Details returns the structure of err: its subjects, message and code, and
+// the errors nested in it with With, Join or a Builder as children.
+func Details(err error) *Detail {
+	if err == nil {
+		return nil
+	}
+	//nolint:errorlint
+	switch err := err.(type) {
+	case baseError:
+		return Details(err.Err)
+	case *baseError:
+		return Details(err.Err)
+	case *codedError:
+		detail := Details(err.Err)
+		detail.Code, detail.Status = err.Code, err.Status
+		return detail
+	case *nestedError:
+		detail := &Detail{}
+		if err.Err != nil {
+			detail = Details(err.Err)
+		}
+		for _, extra := range err.Extras {
+			if extra != nil {
+				detail.Children = append(detail.Children, Details(extra))
+			}
+		}
+		return detail
+	case *withSubject:
+		detail := Details(err.Err)
+		subjects := slices.Clone(err.Subjects)
+		if err.pendingSubject != "" {
+			subjects = append(subjects, err.pendingSubject)
+		}
+		slices.Reverse(subjects)
+		detail.Subjects = append(subjects, detail.Subjects...)
+		return detail
+	case *MultilineError:
+		if err.currentParent == nil {
+			return &Detail{}
+		}
+		return Details(err.currentParent)
+	}
+	if reflect.TypeOf(err) == joinErrorType {
+		return Details(Join(err.(interface{ Unwrap() []error }).Unwrap()...))
+	}
+	detail := &Detail{Message: string(Plain(err))}
+	if coded, ok := errors.AsType[*codedError](err); ok {
+		detail.Code, detail.Status = coded.Code, coded.Status
+	}
+	return detail
+}
+
+// errors.joinError, whose message is only the messages of its errors
+var joinErrorType = reflect.TypeOf(errors.Join(errors.New("foo"), errors.New("bar")))
@@ -0,0 +1,100 @@
+package gperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/strings/ansi"
+)
+
+var errRouteNotFound = WithCode(New("route not found"), "route_not_found", http.StatusNotFound)
+
+func TestWithCode(t *testing.T) {
+	require.Nil(t, WithCode(nil, "foo", http.StatusBadRequest))
+
+	err := errRouteNotFound.Subject("example.com")
+	require.Equal(t, "route_not_found", Code(err))
+	require.Equal(t, http.StatusNotFound, HTTPStatus(err))
+	require.Equal(t, "example.com: route not found", ansi.StripANSI(err.Error()))
+	require.ErrorIs(t, err, errRouteNotFound)
+
+	err = WithCode(err, "route_error", 0)
+	require.Equal(t, "route_error", Code(err))
+	require.Equal(t, http.StatusNotFound, HTTPStatus(err), "zero status keeps the inner status")
+}
+
+func TestCodeNested(t *testing.T) {
+	b := NewBuilder("failed to load routes")
+	b.Add(New("invalid port"))
+	b.Add(errRouteNotFound.Subject("b"))
+	b.Add(WithCode(New("bad request"), "bad_request", http.StatusBadRequest))
+	err := b.Error()
+
+	require.Equal(t, "route_not_found", Code(err), "first code depth-first")
+	require.Equal(t, http.StatusNotFound, HTTPStatus(err))
+
+	wrapped := fmt.Errorf("reload: %w", err)
+	require.Equal(t, "route_not_found", Code(wrapped))
+	require.Equal(t, "route_not_found", Code(Wrap(err, "reload")))
+	require.Equal(t, "route_not_found", Code(Errorf("reload: %w", err)))
+}
+
+func TestCodeNone(t *testing.T) {
+	require.Empty(t, Code(nil))
+	code, status := CodeOf(New("foo"))
+	require.Empty(t, code)
+	require.Zero(t, status)
+	require.Empty(t, Code(errors.New("foo")))
+	require.Equal(t, http.StatusOK, HTTPStatus(nil))
+	require.Equal(t, http.StatusInternalServerError, HTTPStatus(New("foo")))
+}
+
+func TestCodedErrorFormat(t *testing.T) {
+	b := NewBuilder("foo")
+	b.Add(WithCode(New("bar").With(New("baz")), "bar", http.StatusBadRequest))
+	require.Equal(t, "foo\n  • bar\n    • baz\n", b.String())
+
+	data, err := errRouteNotFound.(*codedError).MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"code":"route_not_found","status":404,"err":"route not found"}`, string(data))
+}
+
+func TestDetails(t *testing.T) {
+	require.Nil(t, Details(nil))
+
+	b := NewBuilder("failed to load routes")
+	b.Add(New("invalid port").Subject("a"))
+	b.Add(errRouteNotFound.Subject("backend").Subject("b"))
+	b.Add(WithCode(New("invalid config").With(New("missing host")), "invalid_config", http.StatusBadRequest))
+	b.Add(errors.Join(errors.New("x"), errors.New("y")))
+
+	require.Equal(t, &Detail{
+		Message: "failed to load routes",
+		Children: []*Detail{
+			{Subjects: []string{"a"}, Message: "invalid port"},
+			{Subjects: []string{"b", "backend"}, Message: "route not found", Code: "route_not_found", Status: http.StatusNotFound},
+			{
+				Message:  "invalid config",
+				Code:     "invalid_config",
+				Status:   http.StatusBadRequest,
+				Children: []*Detail{{Message: "missing host"}},
+			},
+			{Children: []*Detail{{Message: "x"}, {Message: "y"}}},
+		},
+	}, Details(b.Error()))
+}
+
+func TestDetailsLeaf(t *testing.T) {
+	require.Equal(t, &Detail{Message: "foo"}, Details(errors.New("foo")))
+	require.Equal(t, &Detail{Message: "foo: bar"}, Details(fmt.Errorf("foo: %w", errors.New("bar"))))
+
+	err := fmt.Errorf("reload: %w", errRouteNotFound)
+	require.Equal(t, &Detail{
+		Message: "reload: route not found",
+		Code:    "route_not_found",
+		Status:  http.StatusNotFound,
+	}, Details(err))
+}
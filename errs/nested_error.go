@@ -160,6 +160,8 @@ func appendLines(buf []byte, errs []error, level int, appendLine appendLineFunc)
 			} else {
 				buf = appendLines(buf, err.Extras, level, appendLine)
 			}
+		case *codedError:
+			buf = appendLines(buf, []error{err.Err}, level, appendLine)
 		default:
 			if err == nil {
 				continue
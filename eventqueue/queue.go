@@ -5,6 +5,7 @@ import (
 	"time"
 
 	gperr "github.com/yusing/goutils/errs"
+	"github.com/yusing/goutils/mockable"
 	"github.com/yusing/goutils/task"
 )
 
@@ -12,7 +13,7 @@ type (
 	EventQueue[Event any] struct {
 		task    *task.Task
 		queue   []Event
-		ticker  *time.Ticker
+		ticker  mockable.Ticker
 		onFlush OnFlushFunc[Event]
 		onError OnErrorFunc
 		debug   bool
@@ -49,6 +50,8 @@ const (
 // but the onFlush function can return earlier (e.g. run in another goroutine).
 //
 // If task is canceled before the flushInterval is reached, the events in queue will be discarded.
+//
+// The flush interval is measured with the clock of queueTask, see task.Task.SetClock.
 func New[Event any](queueTask *task.Task, opt Options[Event]) *EventQueue[Event] {
 	capacity := defaultEventQueueCapacity
 	if opt.Capacity > 0 {
@@ -60,7 +63,7 @@ func New[Event any](queueTask *task.Task, opt Options[Event]) *EventQueue[Event]
 	return &EventQueue[Event]{
 		task:    queueTask,
 		queue:   make([]Event, 0, capacity),
-		ticker:  time.NewTicker(opt.FlushInterval),
+		ticker:  queueTask.Clock().NewTicker(opt.FlushInterval),
 		onFlush: opt.OnFlush,
 		onError: opt.OnError,
 		debug:   opt.Debug,
@@ -120,7 +123,7 @@ func (e *EventQueue[Event]) Start(eventCh <-chan Event, errCh <-chan error) {
 			select {
 			case <-e.task.Context().Done():
 				return
-			case <-e.ticker.C:
+			case <-e.ticker.C():
 				if flushDone == nil && len(e.queue) > 0 {
 					flushDone = startFlush()
 				}
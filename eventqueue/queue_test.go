@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/mockable"
 	"github.com/yusing/goutils/task"
 )
 
@@ -84,3 +85,27 @@ func receiveFlushedEvents(t *testing.T, flushed <-chan []int) []int {
 		return nil
 	}
 }
+
+func TestFlushIntervalUsesTaskClock(t *testing.T) {
+	clock := mockable.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queueTask := task.GetTestTask(t).Subtask("event_queue", true)
+	queueTask.SetClock(clock)
+	t.Cleanup(func() { queueTask.FinishAndWait(nil) })
+
+	eventCh := make(chan int)
+	flushed := make(chan []int, 1)
+	queue := New(queueTask, Options[int]{
+		FlushInterval: time.Minute,
+		OnFlush: func(events []int) {
+			flushed <- append([]int(nil), events...)
+		},
+	})
+	queue.Start(eventCh, nil)
+
+	eventCh <- 1
+	eventCh <- 2
+	clock.Advance(59 * time.Second)
+	require.Empty(t, flushed)
+	clock.Advance(time.Second)
+	require.Equal(t, []int{1, 2}, receiveFlushedEvents(t, flushed))
+}
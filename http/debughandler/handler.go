@@ -0,0 +1,141 @@
+// Package debughandler serves the live state of a program, like
+// net/http/pprof: its task tree, pending callbacks, stuck tasks, buffer pool
+// stats and any extra sections such as cache stats.
+package debughandler
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	httputils "github.com/yusing/goutils/http"
+	strutils "github.com/yusing/goutils/strings"
+	"github.com/yusing/goutils/synk"
+	"github.com/yusing/goutils/task"
+)
+
+// DefaultStuckAfter is how long a task may take to finish before Handler
+// reports it as stuck, when Handler.StuckAfter is not set.
+const DefaultStuckAfter = 10 * time.Second
+
+// Handler serves a State as HTML to browsers and as JSON to clients that
+// do not accept HTML:
+//
+//	http.Handle("/debug/state", &debughandler.Handler{
+//		Sections: map[string]func() any{
+//			"caches": func() any { return cache.RegisteredStats() },
+//		},
+//	})
+type Handler struct {
+	// StuckAfter is how long a task may take to finish before it is
+	// reported as stuck. Defaults to DefaultStuckAfter.
+	StuckAfter time.Duration
+	// Sections are extra values to show, by title. Each is called once per
+	// request and must return a value that can be encoded as JSON.
+	Sections map[string]func() any
+}
+
+// State is what Handler serves.
+type State struct {
+	// Tasks is the tree of every task, see task.Snapshot.
+	Tasks *task.Tree `json:"tasks"`
+	// PendingCallbacks lists the OnCancel and OnFinished callbacks that have
+	// not returned yet, as "<task>: <callback>".
+	PendingCallbacks []string `json:"pending_callbacks"`
+	// Stuck lists the tasks whose Finish was called more than StuckAfter ago
+	// but which are still attached to their parent, without their children.
+	Stuck []*task.Tree `json:"stuck"`
+	// Pools are the buffer pool counters, see synk.ReadPoolStats.
+	Pools    synk.PoolStats `json:"pools"`
+	Sections map[string]any `json:"sections,omitempty"`
+}
+
+// State collects the current state.
+func (h *Handler) State() *State {
+	stuckAfter := h.StuckAfter
+	if stuckAfter <= 0 {
+		stuckAfter = DefaultStuckAfter
+	}
+
+	tasks := task.Snapshot()
+	state := &State{
+		Tasks:            tasks,
+		PendingCallbacks: []string{},
+		Stuck:            []*task.Tree{},
+		Pools:            synk.ReadPoolStats(),
+	}
+	for t := range tasks.Walk {
+		for _, about := range t.OnCancel {
+			state.PendingCallbacks = append(state.PendingCallbacks, t.FullName+": "+about)
+		}
+		for _, about := range t.OnFinished {
+			state.PendingCallbacks = append(state.PendingCallbacks, t.FullName+": "+about)
+		}
+	}
+	for _, stuck := range tasks.Stuck(stuckAfter) {
+		stuck := *stuck
+		stuck.Children = nil
+		state.Stuck = append(state.Stuck, &stuck)
+	}
+	if len(h.Sections) > 0 {
+		state.Sections = make(map[string]any, len(h.Sections))
+		for title, section := range h.Sections {
+			state.Sections[title] = section()
+		}
+	}
+	return state
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := h.State()
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !httputils.GetAccept(r.Header).AcceptHTML() {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := strutils.NewJSONEncoder(w).Encode(state); err != nil {
+			log.Err(err).Msg("debughandler: failed to write state")
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, newPage(state)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+//go:embed page.html
+var pageHTML string
+
+var pageTemplate = template.Must(template.New("page").Parse(pageHTML))
+
+type page struct {
+	*State
+	TaskTree string
+	Sections map[string]string
+}
+
+func newPage(state *State) *page {
+	p := &page{State: state}
+
+	var buf bytes.Buffer
+	_ = state.Tasks.WriteText(&buf)
+	p.TaskTree = buf.String()
+
+	p.Sections = make(map[string]string, len(state.Sections))
+	for title, section := range state.Sections {
+		b, err := strutils.MarshalJSONIndent(section, "", "  ")
+		if err != nil {
+			p.Sections[title] = err.Error()
+			continue
+		}
+		p.Sections[title] = string(b)
+	}
+	return p
+}
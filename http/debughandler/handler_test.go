@@ -0,0 +1,74 @@
+package debughandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	strutils "github.com/yusing/goutils/strings"
+	"github.com/yusing/goutils/task"
+)
+
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	app := task.RootTask(t.Name(), true)
+	release := make(chan struct{})
+	t.Cleanup(func() {
+		close(release)
+		app.FinishAndWait(nil)
+	})
+	app.OnCancel("stop listener", func() {})
+	stuck := app.Subtask("stuck", true)
+	stuck.OnFinished("flush <buffers>", func() { <-release })
+	stuck.Finish(nil)
+
+	return &Handler{
+		StuckAfter: time.Nanosecond,
+		Sections: map[string]func() any{
+			"caches": func() any { return map[string]int{"icons": 1} },
+		},
+	}
+}
+
+func TestHandler_JSON(t *testing.T) {
+	h := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/state", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	var state State
+	require.NoError(t, strutils.UnmarshalJSON(rec.Body.Bytes(), &state))
+	assert.Equal(t, "root", state.Tasks.Name)
+	assert.Contains(t, state.PendingCallbacks, t.Name()+": stop listener")
+	assert.Contains(t, state.PendingCallbacks, t.Name()+".stuck: flush <buffers>")
+	require.Len(t, state.Stuck, 1)
+	assert.Equal(t, t.Name()+".stuck", state.Stuck[0].FullName)
+	assert.Equal(t, task.StatusFinishing, state.Stuck[0].Status)
+	assert.Equal(t, map[string]any{"icons": float64(1)}, state.Sections["caches"])
+}
+
+func TestHandler_HTML(t *testing.T) {
+	h := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/state", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.Contains(t, body, "<h2>Stuck tasks (1)</h2>")
+	assert.Contains(t, body, "flush &lt;buffers&gt; (on finished)")
+	assert.Contains(t, body, "<h2>caches</h2>")
+	assert.Contains(t, body, "&#34;icons&#34;: 1")
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
 	"github.com/yusing/goutils/env"
+	"github.com/yusing/goutils/mockable"
 	strutils "github.com/yusing/goutils/strings"
 	"github.com/yusing/goutils/synk"
 )
@@ -26,7 +27,8 @@ type Manager struct {
 	ctx              context.Context
 	cancel           context.CancelFunc
 	pongWriteTimeout time.Duration
-	pingCheckTicker  *time.Ticker
+	pingCheckTicker  mockable.Ticker
+	clock            mockable.Clock
 	lastPingTime     synk.Value[time.Time]
 	readCh           chan []byte
 	err              synk.Value[error]
@@ -81,11 +83,19 @@ const (
 // If the upgrade succeeds, the Manager is returned.
 //
 // To use a custom upgrader, set the "upgrader" context value to the upgrader.
+//
+// To use a custom clock for the ping check, PeriodicWrite and read
+// timeouts, e.g. a mockable.FakeClock in tests, set the "clock" context
+// value to a mockable.Clock. Write deadlines always use the real clock.
 func NewManagerWithUpgrade(c *gin.Context) (*Manager, error) {
 	actualUpgrader := &defaultUpgrader
 	if upgrader, ok := c.Get("upgrader"); ok {
 		actualUpgrader = upgrader.(*websocket.Upgrader)
 	}
+	clock := mockable.RealClock
+	if v, ok := c.Get("clock"); ok {
+		clock = v.(mockable.Clock)
+	}
 
 	conn, err := actualUpgrader.Upgrade(c.Writer, c.Request, websocketUpgradeResponseHeader(c.Request))
 	if err != nil {
@@ -101,10 +111,11 @@ func NewManagerWithUpgrade(c *gin.Context) (*Manager, error) {
 		ctx:              ctx,
 		cancel:           cancel,
 		pongWriteTimeout: 2 * time.Second,
-		pingCheckTicker:  time.NewTicker(3 * time.Second),
+		pingCheckTicker:  clock.NewTicker(3 * time.Second),
+		clock:            clock,
 		readCh:           make(chan []byte, 1),
 	}
-	cm.lastPingTime.Store(time.Now())
+	cm.lastPingTime.Store(clock.Now())
 
 	conn.SetCloseHandler(func(code int, text string) error {
 		if envDebug && code != websocket.CloseNormalClosure && code != websocket.CloseGoingAway {
@@ -200,13 +211,13 @@ func (cm *Manager) PeriodicWrite(interval time.Duration, getData func() (any, er
 		equals = DeepEqual
 	}
 
-	ticker := time.NewTicker(interval)
+	ticker := cm.clock.NewTicker(interval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-cm.ctx.Done():
 			return cm.err.Load()
-		case <-ticker.C:
+		case <-ticker.C():
 			write()
 			if err := cm.err.Load(); err != nil {
 				return err
@@ -263,23 +274,23 @@ func (cm *Manager) ReadCh() <-chan []byte {
 // If the message fails to unmarshal, the error is returned.
 // If the read timeout is reached, ErrReadTimeout is returned.
 func (cm *Manager) ReadJSON(out any, timeout time.Duration) error {
-	select {
-	case <-cm.ctx.Done():
-		return cm.err.Load()
-	case data := <-cm.readCh:
-		return strutils.UnmarshalJSON(data, out)
-	case <-time.After(timeout):
-		return ErrReadTimeout
+	data, err := cm.ReadBinary(timeout)
+	if err != nil {
+		return err
 	}
+	return strutils.UnmarshalJSON(data, out)
 }
 
 func (cm *Manager) ReadBinary(timeout time.Duration) ([]byte, error) {
+	timer := cm.clock.NewTimer(timeout)
+	defer timer.Stop()
+
 	select {
 	case <-cm.ctx.Done():
 		return nil, cm.err.Load()
 	case data := <-cm.readCh:
 		return data, nil
-	case <-time.After(timeout):
+	case <-timer.C():
 		return nil, ErrReadTimeout
 	}
 }
@@ -320,8 +331,8 @@ func (cm *Manager) pingCheckRoutine() {
 		select {
 		case <-cm.ctx.Done():
 			return
-		case <-cm.pingCheckTicker.C:
-			if time.Since(cm.lastPingTime.Load()) > 5*time.Second {
+		case <-cm.pingCheckTicker.C():
+			if cm.clock.Since(cm.lastPingTime.Load()) > 5*time.Second {
 				if envDebug {
 					cm.setErrIfNil(errors.New("no ping received in 5 seconds, closing connection"))
 				}
@@ -348,7 +359,7 @@ func (cm *Manager) readRoutine() {
 			}
 
 			if typ == websocket.TextMessage && string(data) == "ping" {
-				cm.lastPingTime.Store(time.Now())
+				cm.lastPingTime.Store(cm.clock.Now())
 				if err := cm.WriteData(websocket.TextMessage, []byte("pong"), cm.pongWriteTimeout); err != nil {
 					cm.setErrIfNil(fmt.Errorf("failed to write pong message: %w", err))
 					cm.Close()
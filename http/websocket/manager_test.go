@@ -5,8 +5,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/yusing/goutils/mockable"
 )
 
 func TestCSRFWebSocketSubprotocol(t *testing.T) {
@@ -67,3 +73,44 @@ func TestManagerSetErrIfNilKeepsFirstConcreteError(t *testing.T) {
 		t.Fatalf("manager error changed from %v to %v", got, cm.err.Load())
 	}
 }
+
+func TestManagerClock(t *testing.T) {
+	clock := mockable.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	result := make(chan error, 2)
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		c.Set("clock", mockable.Clock(clock))
+		manager, err := NewManagerWithUpgrade(c)
+		if err != nil {
+			result <- err
+			return
+		}
+		defer manager.Close()
+		_, err = manager.ReadBinary(4 * time.Second)
+		result <- err
+		<-manager.Done()
+		result <- nil
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("connecting WebSocket: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	clock.BlockUntil(2) // the ping check ticker and the read timer
+	clock.Advance(4 * time.Second)
+	if err := awaitStreamResult(t, result); !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("ReadBinary() error = %v, want %v", err, ErrReadTimeout)
+	}
+
+	// no ping from the client for more than 5 seconds
+	clock.Advance(2 * time.Second)
+	if err := awaitStreamResult(t, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
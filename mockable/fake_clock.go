@@ -0,0 +1,192 @@
+package mockable
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock whose time only moves when Advance is called. Timers
+// and tickers fire during Advance, in the order they are due.
+//
+// AfterFunc functions run in the goroutine calling Advance, rather than in
+// their own, so their effects are visible once Advance returns.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+var _ Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond.L = &c.mu
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("mockable: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.resetTicker(d)
+	return fakeTicker{t}
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	t := &fakeTimer{clock: c, fn: f}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker due
+// by then.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+	for len(c.waiters) > 0 && !c.waiters[0].at.After(target) {
+		t := c.waiters[0]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+			c.sortLocked()
+		} else {
+			c.removeLocked(t)
+		}
+		if t.fn != nil {
+			c.mu.Unlock()
+			t.fn()
+			c.mu.Lock()
+			continue
+		}
+		select {
+		case t.ch <- c.now:
+		default: // dropped, like a slow reader of a time.Ticker
+		}
+	}
+	c.now = target
+}
+
+// BlockUntil blocks until at least n timers and tickers are waiting to
+// fire, so a test can Advance once the code under test has started waiting.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) addLocked(t *fakeTimer) {
+	c.waiters = append(c.waiters, t)
+	c.sortLocked()
+	c.cond.Broadcast()
+}
+
+func (c *FakeClock) removeLocked(t *fakeTimer) bool {
+	i := slices.Index(c.waiters, t)
+	if i < 0 {
+		return false
+	}
+	c.waiters = slices.Delete(c.waiters, i, i+1)
+	return true
+}
+
+func (c *FakeClock) sortLocked() {
+	slices.SortStableFunc(c.waiters, func(a, b *fakeTimer) int {
+		return a.at.Compare(b.at)
+	})
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	ch     chan time.Time
+	fn     func()
+	at     time.Time
+	period time.Duration // > 0 for tickers
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.drain()
+	return t.clock.removeLocked(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	return t.reset(d, 0)
+}
+
+func (t *fakeTimer) resetTicker(d time.Duration) {
+	t.reset(d, d)
+}
+
+func (t *fakeTimer) reset(d, period time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active := c.removeLocked(t)
+	t.drain()
+	t.at = c.now.Add(d)
+	t.period = period
+	if d <= 0 && period == 0 {
+		// already due, like a time.Timer
+		if t.fn != nil {
+			go t.fn()
+		} else {
+			t.ch <- t.at
+		}
+		return active
+	}
+	c.addLocked(t)
+	return active
+}
+
+// drain drops a value sent before Stop or Reset, which a time.Timer does
+// not deliver either since Go 1.23.
+func (t *fakeTimer) drain() {
+	if t.ch == nil {
+		return
+	}
+	select {
+	case <-t.ch:
+	default:
+	}
+}
+
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.ch }
+func (t fakeTicker) Stop()               { t.t.Stop() }
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("mockable: non-positive interval for Ticker.Reset")
+	}
+	t.t.resetTicker(d)
+}
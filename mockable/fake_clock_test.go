@@ -0,0 +1,71 @@
+package mockable_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/mockable"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeClockTimer(t *testing.T) {
+	clock := mockable.NewFakeClock(epoch)
+	timer := clock.NewTimer(time.Second)
+
+	clock.Advance(999 * time.Millisecond)
+	require.Empty(t, timer.C())
+	clock.Advance(time.Millisecond)
+	require.Equal(t, epoch.Add(time.Second), <-timer.C())
+	require.False(t, timer.Stop())
+
+	require.False(t, timer.Reset(time.Second))
+	require.True(t, timer.Stop())
+	clock.Advance(time.Hour)
+	require.Empty(t, timer.C())
+	require.Equal(t, time.Hour+time.Second, clock.Since(epoch))
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	clock := mockable.NewFakeClock(epoch)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Second)
+		require.Equal(t, epoch.Add(time.Duration(i)*time.Second), <-ticker.C())
+	}
+	// ticks are dropped while the reader is behind
+	clock.Advance(3 * time.Second)
+	require.Len(t, ticker.C(), 1)
+}
+
+func TestFakeClockAfterFunc(t *testing.T) {
+	clock := mockable.NewFakeClock(epoch)
+	var order []string
+	clock.AfterFunc(2*time.Second, func() { order = append(order, "second") })
+	clock.AfterFunc(time.Second, func() {
+		require.Equal(t, epoch.Add(time.Second), clock.Now())
+		order = append(order, "first")
+	})
+	stopped := clock.AfterFunc(time.Second, func() { order = append(order, "stopped") })
+	require.True(t, stopped.Stop())
+
+	clock.Advance(5 * time.Second)
+	require.Equal(t, []string{"first", "second"}, order)
+	require.Equal(t, epoch.Add(5*time.Second), clock.Now())
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	clock := mockable.NewFakeClock(epoch)
+	fired := make(chan time.Time)
+	go func() {
+		timer := clock.NewTimer(time.Minute)
+		fired <- <-timer.C()
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	require.Equal(t, epoch.Add(time.Minute), <-fired)
+}
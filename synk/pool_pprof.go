@@ -107,18 +107,36 @@ func initPoolStats() {
 	}()
 }
 
-func printPoolStats() {
+// ReadPoolStats returns the bytes pool counters.
+func ReadPoolStats() PoolStats {
 	pruneBuffersInUse()
 
+	return PoolStats{
+		Enabled:       true,
+		SizeInUse:     sizeInUse.Load(),
+		NumReused:     reused.num.Load(),
+		SizeReused:    reused.size.Load(),
+		NumDropped:    dropped.num.Load(),
+		SizeDropped:   dropped.size.Load(),
+		NumNonPooled:  nonPooled.num.Load(),
+		SizeNonPooled: nonPooled.size.Load(),
+		NumGced:       gced.num.Load(),
+		SizeGced:      gced.size.Load(),
+	}
+}
+
+func printPoolStats() {
+	stats := ReadPoolStats()
+
 	log.Info().
-		Str("sizeInUse", strutils.FormatByteSize(sizeInUse.Load())).
-		Uint64("numReused", reused.num.Load()).
-		Str("sizeReused", strutils.FormatByteSize(reused.size.Load())).
-		Uint64("numDropped", dropped.num.Load()).
-		Str("sizeDropped", strutils.FormatByteSize(dropped.size.Load())).
-		Uint64("numNonPooled", nonPooled.num.Load()).
-		Str("sizeNonPooled", strutils.FormatByteSize(nonPooled.size.Load())).
-		Uint64("numGced", gced.num.Load()).
-		Str("sizeGced", strutils.FormatByteSize(gced.size.Load())).
+		Str("sizeInUse", strutils.FormatByteSize(stats.SizeInUse)).
+		Uint64("numReused", stats.NumReused).
+		Str("sizeReused", strutils.FormatByteSize(stats.SizeReused)).
+		Uint64("numDropped", stats.NumDropped).
+		Str("sizeDropped", strutils.FormatByteSize(stats.SizeDropped)).
+		Uint64("numNonPooled", stats.NumNonPooled).
+		Str("sizeNonPooled", strutils.FormatByteSize(stats.SizeNonPooled)).
+		Uint64("numGced", stats.NumGced).
+		Str("sizeGced", strutils.FormatByteSize(stats.SizeGced)).
 		Msg("bytes pool stats")
 }
@@ -26,3 +26,14 @@ func TestSizeInUse(t *testing.T) {
 	pool.Put(make([]byte, MinAllocSize))
 	assert.Equal(t, before, sizeInUse.Load(), "foreign buffers must not underflow the metric")
 }
+
+func TestReadPoolStats(t *testing.T) {
+	pool := UnsizedBytesPool{pool: newTypedWeakPool(1)}
+	before := ReadPoolStats()
+	assert.True(t, before.Enabled)
+
+	b := pool.GetAtLeast(2 * MinAllocSize)
+	assert.Equal(t, before.SizeInUse+uint64(cap(b)), ReadPoolStats().SizeInUse)
+	pool.Put(b)
+	assert.Equal(t, before.SizeInUse, ReadPoolStats().SizeInUse)
+}
@@ -2,4 +2,14 @@
 
 package synk
 
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
 func printPoolStats() {}
+
+func TestReadPoolStatsDisabled(t *testing.T) {
+	assert.Zero(t, ReadPoolStats(), "pool stats are only collected with the pprof tag")
+}
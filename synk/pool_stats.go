@@ -0,0 +1,25 @@
+package synk
+
+// PoolStats are the bytes pool counters returned by ReadPoolStats. Sizes are
+// in bytes.
+type PoolStats struct {
+	// Enabled is true when the program was built with the pprof tag. Without
+	// it, Enabled is false and every counter is zero.
+	Enabled bool `json:"enabled"`
+	// SizeInUse is the capacity of the pooled buffers currently handed out.
+	SizeInUse uint64 `json:"size_in_use"`
+	// Reused counts buffers served from the pools.
+	NumReused  uint64 `json:"num_reused"`
+	SizeReused uint64 `json:"size_reused"`
+	// Dropped counts buffers discarded instead of pooled or reused: returned
+	// to a full pool, outside the pooled sizes, or too small for a request.
+	NumDropped  uint64 `json:"num_dropped"`
+	SizeDropped uint64 `json:"size_dropped"`
+	// NonPooled counts buffers allocated because the pools were empty or the
+	// size was too large to pool.
+	NumNonPooled  uint64 `json:"num_non_pooled"`
+	SizeNonPooled uint64 `json:"size_non_pooled"`
+	// Gced counts pooled buffers reclaimed by the garbage collector.
+	NumGced  uint64 `json:"num_gced"`
+	SizeGced uint64 `json:"size_gced"`
+}
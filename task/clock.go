@@ -0,0 +1,25 @@
+package task
+
+import "github.com/yusing/goutils/mockable"
+
+// SetClock sets the clock used by t and the subtasks created from it
+// afterwards, for their start and finish times and the timers of Every,
+// AfterFunc and Supervise. A nil clock restores the real clock. Subtasks
+// that already exist keep their clock.
+//
+// Finish timeouts and the shutdown budget always use the real clock.
+func (t *Task) SetClock(clock mockable.Clock) {
+	if clock == nil {
+		t.clock.Store(nil)
+		return
+	}
+	t.clock.Store(&clock)
+}
+
+// Clock returns the clock of t, see SetClock.
+func (t *Task) Clock() mockable.Clock {
+	if clock := t.clock.Load(); clock != nil {
+		return *clock
+	}
+	return mockable.RealClock
+}
@@ -0,0 +1,40 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/mockable"
+)
+
+func TestTaskClock(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	clock := mockable.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	parent := RootTask("parent", true)
+	before := parent.Subtask("before", false)
+	parent.SetClock(clock)
+	child := parent.Subtask("child", false)
+
+	require.Equal(t, mockable.RealClock, before.Clock())
+	require.Same(t, clock, child.Clock())
+	require.Equal(t, clock.Now(), child.startedAt)
+
+	clock.Advance(time.Minute)
+	require.Equal(t, time.Minute, child.Tree().Age)
+
+	calls := make(chan struct{}, 1)
+	parent.Every("tick", time.Hour, 0, func(ctx context.Context) error {
+		calls <- struct{}{}
+		return nil
+	})
+	clock.BlockUntil(1)
+	clock.Advance(59 * time.Minute)
+	require.Empty(t, calls)
+	clock.Advance(time.Minute)
+	<-calls
+
+	parent.FinishAndWait(nil)
+}
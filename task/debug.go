@@ -24,12 +24,28 @@ func (s *stuckSubtree) collect(t *Task) {
 	}
 	if t.children != nil {
 		for child := range t.children.Range {
-			s.children = append(s.children, child.String())
+			s.children = append(s.children, child.String()+child.shutdownNote())
 			s.collect(child)
 		}
 	}
 }
 
+// handleStuck is called when t gives up waiting for its children and
+// callbacks. It calls the OnStuck option of t if set, otherwise it logs the
+// stuck report when report is true.
+func (t *Task) handleStuck(cause error, report bool) {
+	if t.onStuck != nil {
+		invokeWithRecover(t, &Callback{
+			fn:    func() { t.onStuck(t, cause) },
+			about: "on stuck",
+		})
+		return
+	}
+	if report {
+		t.reportStucked(cause)
+	}
+}
+
 func (t *Task) reportStucked(cause error) {
 	var stuck stuckSubtree
 	stuck.collect(t)
@@ -0,0 +1,77 @@
+package task
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitExitReload(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	reloads := 0
+	app := RootTask("app", false)
+	sig := make(chan os.Signal, 4)
+	sig <- syscall.SIGHUP
+	sig <- syscall.SIGHUP // failed reloads keep the program running
+	sig <- syscall.SIGHUP
+	sig <- syscall.SIGTERM
+
+	err := waitExit(sig, ExitOptions{
+		ShutdownTimeout: time.Second,
+		Reload: func() error {
+			reloads++
+			switch reloads {
+			case 2:
+				return errors.New("bad config")
+			case 3:
+				panic("bad config")
+			}
+			require.NoError(t, app.Context().Err())
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, reloads)
+	require.ErrorIs(t, app.FinishCause(), ErrProgramExiting)
+}
+
+func TestWaitExitReturnsShutdownError(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	RootTask("app", false).OnCancel("blocked", func() { <-release })
+
+	sig := make(chan os.Signal, 1)
+	sig <- syscall.SIGINT
+	require.Error(t, waitExit(sig, ExitOptions{ShutdownTimeout: 50 * time.Millisecond}))
+}
+
+func TestWaitExitForceExit(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	exited := make(chan int, 1)
+	osExit = func(code int) { exited <- code }
+	t.Cleanup(func() { osExit = os.Exit })
+
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	RootTask("app", false).OnCancel("blocked", func() { <-release })
+
+	sig := make(chan os.Signal, 2)
+	sig <- syscall.SIGTERM
+	sig <- syscall.SIGINT
+	require.Error(t, waitExit(sig, ExitOptions{ShutdownTimeout: time.Second, ForceExit: true}))
+
+	select {
+	case code := <-exited:
+		require.Equal(t, 1, code)
+	default:
+		t.Fatal("second signal did not force an exit")
+	}
+}
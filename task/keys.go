@@ -0,0 +1,106 @@
+package task
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Key is a typed key for task values, so callers do not need to assert the
+// type of what GetValue returns:
+//
+//	var historyKey = task.NewKey[*events.History]("history")
+//
+//	historyKey.Set(parent, history)
+//	history, ok := historyKey.Get(child)
+//
+// Keys are compared by identity, so two keys with the same name are
+// different keys.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key for values of type T. The name is only used to
+// describe the key.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+// String returns the name of the key.
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// Set sets the value of k on t, for t and its subtasks, see Task.SetValue.
+func (k *Key[T]) Set(t Parent, value T) {
+	t.SetValue(k, value)
+}
+
+// Get returns the value of k set on t or its nearest ancestor that has one,
+// see Task.GetValue.
+func (k *Key[T]) Get(t Parent) (T, bool) {
+	value, ok := t.GetValue(k).(T)
+	return value, ok
+}
+
+// MustGet is like Get, but panics if the value is not set.
+func (k *Key[T]) MustGet(t Parent) T {
+	value, ok := k.Get(t)
+	if !ok {
+		panic(fmt.Sprintf("task: %q is not set on %s or its parents", k.name, t.Name()))
+	}
+	return value
+}
+
+// FromContext returns the value of k from a context derived from a task
+// context, see Task.Context.
+func (k *Key[T]) FromContext(ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(k).(T)
+	return value, ok
+}
+
+// Value is a value visible from a task, see Task.Values.
+type Value struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+	// Owner is the full name of the task the value was set on.
+	Owner string `json:"owner"`
+}
+
+// Values returns the values GetValue would find on t, sorted by key. A
+// value set on t or a nearer ancestor hides the values of the same key set
+// further up.
+func (t *Task) Values() []Value {
+	var values []Value
+	seen := make(map[any]struct{})
+	for cur := t; ; cur = cur.parent {
+		if m := cur.values.Load(); m != nil {
+			m.Range(func(key, value any) bool {
+				if _, ok := seen[key]; !ok {
+					seen[key] = struct{}{}
+					values = append(values, Value{Key: keyString(key), Value: value, Owner: cur.String()})
+				}
+				return true
+			})
+		}
+		if cur.parent.isRoot() {
+			break
+		}
+	}
+	slices.SortFunc(values, func(a, b Value) int {
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return values
+}
+
+func keyString(key any) string {
+	switch key := key.(type) {
+	case string:
+		return key
+	case fmt.Stringer:
+		return key.String()
+	default:
+		return fmt.Sprintf("%T(%v)", key, key)
+	}
+}
@@ -0,0 +1,94 @@
+package task
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Observer receives task lifecycle events, e.g. to record spans or metrics.
+//
+// Events are delivered synchronously from the goroutine that causes them,
+// so an Observer must be safe for concurrent use and return quickly. A
+// panic in an Observer is recovered and logged.
+type Observer interface {
+	// OnStart is called when t is created by Subtask or RootTask.
+	OnStart(t *Task)
+	// OnFinishCalled is called the first time Finish or FinishAndWait is
+	// called on t, with the cause t finishes with.
+	OnFinishCalled(t *Task, cause error)
+	// OnFinished is called once t is finished and its children and
+	// callbacks have returned, or the wait for them timed out, with the time
+	// since t was started.
+	OnFinished(t *Task, duration time.Duration)
+	// OnCallbackPanic is called when the OnCancel or OnFinished callback of t
+	// named about panics with v.
+	OnCallbackPanic(t *Task, about string, v any)
+}
+
+var globalObserver atomic.Pointer[Observer]
+
+// SetObserver sets the Observer receiving the events of every task, or
+// removes it when o is nil. It is called alongside the per-subtree observer
+// set by Task.SetObserver, if any: an Observer set both ways receives every
+// event twice.
+func SetObserver(o Observer) {
+	if o == nil {
+		globalObserver.Store(nil)
+		return
+	}
+	globalObserver.Store(&o)
+}
+
+// SetObserver sets the Observer receiving the events of t and of the
+// subtasks created from it afterwards, or removes it when o is nil.
+// Subtasks that already exist keep their observer.
+func (t *Task) SetObserver(o Observer) {
+	if o == nil {
+		t.observer.Store(nil)
+		return
+	}
+	t.observer.Store(&o)
+}
+
+// observe calls fn with the per-subtree and the global observer of t. It
+// costs two atomic loads when none is set.
+func (t *Task) observe(fn func(o Observer)) {
+	local, global := t.observer.Load(), globalObserver.Load()
+	if local == nil && global == nil {
+		return
+	}
+	if local != nil {
+		notifyObserver(t, *local, fn)
+	}
+	if global != nil {
+		notifyObserver(t, *global, fn)
+	}
+}
+
+func notifyObserver(t *Task, o Observer, fn func(o Observer)) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Err(fmtCause(err)).Str("task", t.String()).Msg("observer panic")
+			panicWithDebugStack()
+		}
+	}()
+	fn(o)
+}
+
+func observeStart(t *Task) {
+	t.observe(func(o Observer) { o.OnStart(t) })
+}
+
+func observeFinishCalled(t *Task) {
+	t.observe(func(o Observer) { o.OnFinishCalled(t, t.FinishCause()) })
+}
+
+func observeFinished(t *Task) {
+	t.observe(func(o Observer) { o.OnFinished(t, t.Clock().Since(t.startedAt)) })
+}
+
+func observeCallbackPanic(t *Task, about string, v any) {
+	t.observe(func(o Observer) { o.OnCallbackPanic(t, about, v) })
+}
@@ -0,0 +1,37 @@
+//go:build !debug
+
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type panickingObserver struct{ observerRecorder }
+
+func (*panickingObserver) OnStart(t *Task) { panic("observer") }
+
+func TestObserverPanicDoesNotBreakTasks(t *testing.T) {
+	t.Cleanup(testCleanup)
+	var recorder panickingObserver
+	SetObserver(&recorder)
+	t.Cleanup(func() { SetObserver(nil) })
+
+	app := RootTask("app", true)
+	app.OnCancel("boom", func() { panic("callback") })
+	app.FinishAndWait(nil)
+
+	require.Eventually(t, func() bool {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return len(recorder.events) == 3
+	}, time.Second, 5*time.Millisecond)
+	assert.ElementsMatch(t, []string{
+		"finish app: context canceled",
+		"panic app boom: callback",
+		"finished app",
+	}, recorder.take())
+}
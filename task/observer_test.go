@@ -0,0 +1,113 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type observerRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *observerRecorder) record(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *observerRecorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func (r *observerRecorder) OnStart(t *Task) { r.record("start %s", t) }
+func (r *observerRecorder) OnFinishCalled(t *Task, cause error) {
+	r.record("finish %s: %v", t, cause)
+}
+
+func (r *observerRecorder) OnFinished(t *Task, duration time.Duration) {
+	if duration <= 0 {
+		panic("duration must be positive")
+	}
+	r.record("finished %s", t)
+}
+
+func (r *observerRecorder) OnCallbackPanic(t *Task, about string, v any) {
+	r.record("panic %s %s: %v", t, about, v)
+}
+
+func TestSetObserver(t *testing.T) {
+	t.Cleanup(testCleanup)
+	var recorder observerRecorder
+	SetObserver(&recorder)
+	t.Cleanup(func() { SetObserver(nil) })
+
+	app := RootTask("app", true)
+	child := app.Subtask("child", true)
+	child.Finish(errors.New("done"))
+	app.FinishAndWait(nil)
+
+	assert.Equal(t, []string{
+		"start app",
+		"start app.child",
+		"finish app.child: done",
+		"finished app.child",
+		"finish app: context canceled",
+		"finished app",
+	}, recorder.take())
+
+	SetObserver(nil)
+	RootTask("unobserved", false).Finish(nil)
+	assert.Empty(t, recorder.take())
+}
+
+func TestTaskSetObserver(t *testing.T) {
+	t.Cleanup(testCleanup)
+	var recorder, global observerRecorder
+	SetObserver(&global)
+	t.Cleanup(func() { SetObserver(nil) })
+
+	app := RootTask("app", false)
+	existing := app.Subtask("existing", false)
+	app.SetObserver(&recorder)
+	child := app.Subtask("child", false)
+	RootTask("other", false).Finish(nil)
+
+	child.Finish(nil)
+	existing.Finish(nil)
+	assert.Equal(t, []string{
+		"start app.child",
+		"finish app.child: context canceled",
+		"finished app.child",
+	}, recorder.take(), "only the subtree created after SetObserver is observed")
+	assert.Len(t, global.take(), 10, "the global observer still sees every task")
+	app.Finish(nil)
+}
+
+// nonComparableObserver panics when compared with ==.
+type nonComparableObserver struct {
+	*observerRecorder
+	_ func()
+}
+
+func TestObserverNotComparable(t *testing.T) {
+	t.Cleanup(testCleanup)
+	var recorder observerRecorder
+	SetObserver(nonComparableObserver{observerRecorder: &recorder})
+	t.Cleanup(func() { SetObserver(nil) })
+
+	app := RootTask("app", false)
+	app.SetObserver(nonComparableObserver{observerRecorder: &recorder})
+	app.Subtask("child", false).Finish(nil)
+	app.Finish(nil)
+	assert.Len(t, recorder.take(), 11, "both observers see the subtree after SetObserver")
+}
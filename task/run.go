@@ -0,0 +1,142 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Go runs fn in a goroutine on a new needFinish subtask of t named name,
+// and finishes the subtask when fn returns, with the error fn returns, or
+// ErrPanicked if it panics, as its finish cause. fn should return once ctx
+// is done.
+func (t *Task) Go(name string, fn func(ctx context.Context) error) *Task {
+	sub := t.Subtask(name, true)
+	done := make(chan struct{})
+	// keep the subtask attached until fn has returned
+	sub.OnFinished("go", func() { <-done })
+	goLabeled(sub, func() {
+		err := callWithRecover(sub, func() error { return fn(sub.Context()) })
+		close(done)
+		sub.Finish(err)
+	})
+	return sub
+}
+
+// Every calls fn every interval, plus a random delay of up to jitter, on a
+// new needFinish subtask of t named name, until the subtask or t is
+// finished. A call that is still running when the next one is due makes
+// that one skipped. Errors and panics of fn are logged and do not stop the
+// calls.
+//
+// Like time.NewTicker, it panics if interval is not positive.
+func (t *Task) Every(name string, interval, jitter time.Duration, fn func(ctx context.Context) error) *Task {
+	if interval <= 0 {
+		panic("task: non-positive interval for Every")
+	}
+	sub := t.Subtask(name, true)
+	done := make(chan struct{})
+	// keep the subtask attached until the last call has returned
+	sub.OnFinished("every", func() { <-done })
+	goLabeled(sub, func() {
+		everyLoop(sub, interval, jitter, fn)
+		close(done)
+		sub.Finish(nil)
+	})
+	return sub
+}
+
+func everyLoop(t *Task, interval, jitter time.Duration, fn func(ctx context.Context) error) {
+	var (
+		running sync.WaitGroup
+		busy    atomic.Bool
+	)
+	defer running.Wait()
+
+	ctx := t.Context()
+	timer := t.Clock().NewTimer(everyDelay(interval, jitter))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+		}
+		if busy.CompareAndSwap(false, true) {
+			running.Go(func() {
+				defer busy.Store(false)
+				if err := callWithRecover(t, func() error { return fn(ctx) }); err != nil {
+					log.Err(err).Str("task", t.String()).Msg("periodic call failed")
+				}
+			})
+		} else {
+			log.Debug().Str("task", t.String()).Msg("periodic call skipped, the previous one is still running")
+		}
+		timer.Reset(everyDelay(interval, jitter))
+	}
+}
+
+func everyDelay(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + rand.N(jitter)
+}
+
+// AfterFunc calls fn in its own goroutine after d, unless t is finished
+// first. fn runs on a new needFinish subtask of t, so finishing t waits for
+// a call that already started, like Go. A panic in fn is logged. The
+// returned stop function cancels the call, and reports whether it did, like
+// time.Timer.Stop.
+func (t *Task) AfterFunc(d time.Duration, fn func()) (stop func() bool) {
+	ctx := t.Context()
+	timer := t.Clock().AfterFunc(d, func() {
+		if ctx.Err() != nil {
+			return
+		}
+		sub := t.Subtask("after_func", true)
+		withLabel(sub, func() {
+			_ = callWithRecover(sub, func() error {
+				fn()
+				return nil
+			})
+		})
+		sub.Finish(nil)
+	})
+	stopOnCancel := context.AfterFunc(ctx, func() { timer.Stop() })
+	return func() bool {
+		stopOnCancel()
+		return timer.Stop()
+	}
+}
+
+// goLabeled runs fn in a new goroutine, see withLabel.
+func goLabeled(t *Task, fn func()) {
+	go withLabel(t, fn)
+}
+
+// withLabel calls fn with the "task" pprof label set to the name of t, so
+// goroutine dumps and leak reports tell which task a goroutine belongs to.
+// Goroutines started by fn inherit the label.
+func withLabel(t *Task, fn func()) {
+	pprof.Do(context.Background(), pprof.Labels("task", t.String()), func(context.Context) { fn() })
+}
+
+// callWithRecover calls fn, turning a panic into an ErrPanicked error that
+// is logged with the stack and the name of t.
+func callWithRecover(t *Task, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%w: %v", ErrPanicked, v)
+			log.Err(err).Str("task", t.String()).Str("stack", string(debug.Stack())).Msg("task panicked")
+		}
+	}()
+	return fn()
+}
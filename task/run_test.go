@@ -0,0 +1,139 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskGo(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	parent := RootTask("parent", true)
+	errBoom := errors.New("boom")
+	failed := parent.Go("failed", func(ctx context.Context) error { return errBoom })
+	panicked := parent.Go("panicked", func(ctx context.Context) error { panic("boom") })
+	canceled := parent.Go("canceled", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	require.Eventually(t, func() bool { return parent.children.Len() == 1 }, time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, failed.FinishCause(), errBoom)
+	require.ErrorIs(t, panicked.FinishCause(), ErrPanicked)
+
+	parent.FinishAndWait(nil)
+	require.ErrorIs(t, canceled.FinishCause(), context.Canceled)
+	require.Zero(t, parent.children.Len())
+}
+
+func TestTaskEvery(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	parent := RootTask("parent", true)
+	var calls, running, overlapped atomic.Int32
+	parent.Every("tick", 10*time.Millisecond, 5*time.Millisecond, func(ctx context.Context) error {
+		if running.Add(1) > 1 {
+			overlapped.Store(1)
+		}
+		defer running.Add(-1)
+		if calls.Add(1) == 2 {
+			panic("boom")
+		}
+		time.Sleep(25 * time.Millisecond) // longer than the interval
+		return errors.New("failed")
+	})
+
+	require.Eventually(t, func() bool { return calls.Load() >= 4 }, time.Second, 10*time.Millisecond)
+	parent.FinishAndWait(nil)
+	require.Zero(t, running.Load(), "a call outlived its task")
+	require.Zero(t, overlapped.Load(), "calls overlapped")
+	require.Zero(t, parent.children.Len())
+}
+
+func TestTaskEveryNonPositiveInterval(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	parent := RootTask("parent", false)
+	fn := func(ctx context.Context) error { return nil }
+	require.PanicsWithValue(t, "task: non-positive interval for Every", func() {
+		parent.Every("tick", 0, time.Second, fn)
+	})
+	require.Panics(t, func() { parent.Every("tick", -time.Second, 0, fn) })
+	require.Zero(t, parent.children.Len(), "no subtask should be started")
+	parent.Finish(nil)
+}
+
+func TestTaskAfterFunc(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	parent := RootTask("parent", false)
+	called := make(chan struct{})
+	parent.AfterFunc(10*time.Millisecond, func() { close(called) })
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("AfterFunc was not called")
+	}
+
+	var stoppedCalled atomic.Bool
+	stop := parent.AfterFunc(10*time.Millisecond, func() { stoppedCalled.Store(true) })
+	require.True(t, stop())
+
+	var canceledCalled atomic.Bool
+	stop = parent.AfterFunc(10*time.Millisecond, func() { canceledCalled.Store(true) })
+	parent.Finish(nil)
+	time.Sleep(30 * time.Millisecond)
+	require.False(t, stop(), "finishing the task should have stopped the timer")
+	require.False(t, stoppedCalled.Load())
+	require.False(t, canceledCalled.Load())
+}
+
+func TestTaskAfterFuncFinishWaits(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	parent := RootTask("parent", true)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var returned atomic.Bool
+	parent.AfterFunc(0, func() {
+		close(started)
+		<-release
+		returned.Store(true)
+	})
+	<-started
+
+	finished := make(chan struct{})
+	go func() {
+		parent.FinishAndWait(nil)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		t.Fatal("FinishAndWait returned while the AfterFunc call was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-finished
+	require.True(t, returned.Load())
+	require.Zero(t, parent.children.Len())
+}
+
+func TestTaskGoLabel(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	parent := RootTask("parent", true)
+	stack := make(chan string, 1)
+	parent.Go("worker", func(ctx context.Context) error {
+		buf := make([]byte, 1024)
+		stack <- string(buf[:runtime.Stack(buf, false)])
+		return nil
+	})
+	require.Contains(t, <-stack, "{task: parent.worker}")
+	parent.FinishAndWait(nil)
+}
@@ -0,0 +1,171 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownPhase orders the shutdown of top-level tasks: every task of a
+// phase is finished before the tasks of the next phase are canceled.
+type ShutdownPhase int
+
+const (
+	// PhaseIngress is for tasks that accept work, such as HTTP servers and
+	// listeners. They are shut down first.
+	PhaseIngress ShutdownPhase = iota - 1
+	// PhaseWorkers is the default phase.
+	PhaseWorkers
+	// PhaseStorage is for tasks the others use, such as database pools and
+	// caches. They are shut down last.
+	PhaseStorage
+)
+
+func (p ShutdownPhase) String() string {
+	switch p {
+	case PhaseIngress:
+		return "ingress"
+	case PhaseWorkers:
+		return "workers"
+	case PhaseStorage:
+		return "storage"
+	default:
+		return fmt.Sprintf("ShutdownPhase(%d)", int(p))
+	}
+}
+
+// shutdownOrdered is set once a phase or a dependency is declared, so
+// programs that declare none keep canceling the whole tree at once.
+var shutdownOrdered atomic.Bool
+
+// SetShutdownPhase sets the phase in which the top-level task of t, the one
+// created with RootTask, is canceled by WaitExit. Subtasks are always
+// canceled with their parent, so the phase applies to the whole top-level
+// task.
+//
+// It should be called before the program starts shutting down.
+func (t *Task) SetShutdownPhase(phase ShutdownPhase) {
+	top := t.topLevel()
+	top.mu.Lock()
+	top.phase = phase
+	top.mu.Unlock()
+	shutdownOrdered.Store(true)
+}
+
+// DependsOn declares that t uses other, so WaitExit does not cancel other
+// until t has finished. Like SetShutdownPhase, it orders the top-level tasks
+// of t and other, and has no effect when they share one. Dependencies take
+// precedence over phases: a dependency that contradicts them, or a cycle,
+// holds shutdown up until the shutdown budget runs out.
+//
+// It should be called before the program starts shutting down.
+func (t *Task) DependsOn(other *Task) {
+	top, otherTop := t.topLevel(), other.topLevel()
+	if top == otherTop {
+		return
+	}
+	otherTop.mu.Lock()
+	otherTop.dependents = append(otherTop.dependents, top)
+	otherTop.mu.Unlock()
+	shutdownOrdered.Store(true)
+}
+
+// topLevel returns the ancestor of t created with RootTask, or t itself.
+func (t *Task) topLevel() *Task {
+	for !t.isRoot() && !t.parent.isRoot() {
+		t = t.parent
+	}
+	return t
+}
+
+// shutdownOrder returns the phase of t and the tasks that must finish
+// before t is canceled.
+func (t *Task) shutdownOrder() (ShutdownPhase, []*Task) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.phase, t.dependents
+}
+
+// shutdownNote describes the shutdown order of t for the stuck report, or
+// returns an empty string for a task with the default order.
+func (t *Task) shutdownNote() string {
+	phase, dependents := t.shutdownOrder()
+	if phase == PhaseWorkers && len(dependents) == 0 {
+		return ""
+	}
+	note := " (phase " + phase.String()
+	if len(dependents) > 0 {
+		names := make([]string, len(dependents))
+		for i, dep := range dependents {
+			names[i] = dep.String()
+		}
+		note += ", after " + strings.Join(names, ", ")
+	}
+	return note + ")"
+}
+
+// cancelInOrder cancels the top-level tasks with cause in the order set by
+// SetShutdownPhase and DependsOn, and waits for each to finish before
+// canceling the tasks that come after it. Every wait gives up at the
+// shutdown deadline, leaving the rest to the root wait and its report.
+func cancelInOrder(cause error) {
+	if root.children == nil {
+		return
+	}
+
+	var tasks []*Task
+	for t := range root.children.Range {
+		tasks = append(tasks, t)
+	}
+	finished := make(map[*Task]chan struct{}, len(tasks))
+	for _, t := range tasks {
+		finished[t] = make(chan struct{})
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(0, shutdownDeadline.Load()))
+	defer cancel()
+	waitFor := func(t *Task) bool {
+		ch, ok := finished[t]
+		if !ok {
+			// created after shutdown started, canceled with the root
+			return true
+		}
+		select {
+		case <-ch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Go(func() {
+			defer close(finished[t])
+
+			phase, dependents := t.shutdownOrder()
+			for _, other := range tasks {
+				if otherPhase, _ := other.shutdownOrder(); otherPhase < phase && !waitFor(other) {
+					return
+				}
+			}
+			for _, dep := range dependents {
+				if !waitFor(dep) {
+					return
+				}
+			}
+
+			t.cancel(cause)
+			select {
+			case <-t.done:
+			case <-ctx.Done():
+				return
+			}
+			_ = t.waitFinish(t.waitTimeout())
+		})
+	}
+	wg.Wait()
+}
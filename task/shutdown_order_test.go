@@ -0,0 +1,114 @@
+package task
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// shutdownRecorder records the order in which tasks are canceled. Each task
+// finishes itself a little after its context is done, so a task canceled
+// too early would show up before the one it should have waited for.
+type shutdownRecorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *shutdownRecorder) track(t *Task) {
+	go func() {
+		<-t.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+		r.mu.Lock()
+		r.order = append(r.order, t.Name())
+		r.mu.Unlock()
+		t.Finish(nil)
+	}()
+}
+
+func (r *shutdownRecorder) Order() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.order
+}
+
+func TestShutdownPhases(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	var rec shutdownRecorder
+	db := RootTask("db", true)
+	db.SetShutdownPhase(PhaseStorage)
+	rec.track(db)
+	worker := RootTask("worker", true)
+	rec.track(worker)
+	http := RootTask("http", true)
+	// the phase applies to the top-level task
+	http.Subtask("listener", false).SetShutdownPhase(PhaseIngress)
+	rec.track(http)
+
+	require.NoError(t, gracefulShutdown(time.Second))
+	require.Equal(t, []string{"http", "worker", "db"}, rec.Order())
+}
+
+func TestShutdownDependsOn(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	var rec shutdownRecorder
+	cache := RootTask("cache", true)
+	rec.track(cache)
+	app := RootTask("app", true)
+	rec.track(app)
+	app.Subtask("handler", false).DependsOn(cache)
+
+	require.NoError(t, gracefulShutdown(time.Second))
+	require.Equal(t, []string{"app", "cache"}, rec.Order())
+}
+
+func TestShutdownDependsOnSameTopLevel(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	app := RootTask("app", false)
+	app.Subtask("a", false).DependsOn(app.Subtask("b", false))
+	require.Empty(t, app.dependents)
+	require.False(t, shutdownOrdered.Load())
+}
+
+// Without a declared order the whole tree is canceled at once, as before.
+func TestShutdownUnordered(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	a := RootTask("a", false)
+	b := RootTask("b", false)
+	require.NoError(t, gracefulShutdown(time.Second))
+	require.False(t, shutdownOrdered.Load())
+	require.ErrorIs(t, a.FinishCause(), ErrProgramExiting)
+	require.ErrorIs(t, b.FinishCause(), ErrProgramExiting)
+}
+
+func TestShutdownOrderInStuckReport(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	app := RootTask("app", true)
+	db := RootTask("db", false)
+	db.SetShutdownPhase(PhaseStorage)
+	app.DependsOn(db)
+	db.OnCancel("close", func() { <-release })
+	go func() {
+		<-app.Context().Done()
+		app.Finish(nil)
+	}()
+
+	require.Error(t, gracefulShutdown(100*time.Millisecond))
+
+	var stuck stuckSubtree
+	stuck.collect(root)
+	require.Contains(t, stuck.children, "db (phase storage, after app)")
+
+	tree := db.Tree()
+	require.Equal(t, "storage", tree.Phase)
+	require.Equal(t, []string{"app"}, tree.ShutdownAfter)
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -102,10 +103,54 @@ func TestNestedWaitStaysWithinShutdownBudget(t *testing.T) {
 }
 
 func TestWaitTimeoutTracksShutdownBudget(t *testing.T) {
-	require.Equal(t, taskTimeout, waitTimeout())
+	require.Equal(t, taskTimeout, root.waitTimeout())
 
 	shutdownDeadline.Store(time.Now().Add(50 * time.Millisecond).UnixNano())
 	t.Cleanup(func() { shutdownDeadline.Store(0) })
-	require.Less(t, waitTimeout(), taskTimeout)
-	require.Positive(t, waitTimeout())
+	require.Less(t, root.waitTimeout(), taskTimeout)
+	require.Positive(t, root.waitTimeout())
+}
+
+func TestSubtaskFinishTimeout(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	var (
+		child    *Task
+		stuckErr error
+	)
+	parent := RootTask("parent", true)
+	child = parent.SubtaskWithOptions("child", Options{
+		NeedFinish:    true,
+		FinishTimeout: 50 * time.Millisecond,
+		OnStuck: func(stuck *Task, err error) {
+			require.Same(t, child, stuck)
+			stuckErr = err
+		},
+	})
+	child.OnCancel("blocked", func() { <-release })
+
+	start := time.Now()
+	child.FinishAndWait(nil)
+	require.Less(t, time.Since(start), time.Second)
+	require.ErrorIs(t, stuckErr, context.DeadlineExceeded)
+	require.Zero(t, parent.children.Len())
+
+	parent.Finish(nil)
+}
+
+func TestSubtaskFinishTimeoutTracksShutdownBudget(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	parent := RootTask("parent", false)
+	child := parent.SubtaskWithOptions("child", Options{FinishTimeout: 30 * time.Second})
+	require.Equal(t, 30*time.Second, child.waitTimeout())
+	// the timeout is not inherited
+	require.Equal(t, taskTimeout, child.Subtask("grandchild", false).waitTimeout())
+
+	shutdownDeadline.Store(time.Now().Add(50 * time.Millisecond).UnixNano())
+	t.Cleanup(func() { shutdownDeadline.Store(0) })
+	require.Less(t, child.waitTimeout(), time.Second)
 }
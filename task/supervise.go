@@ -0,0 +1,215 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/goutils/events"
+)
+
+// RestartMode tells Supervise when to run a function again.
+type RestartMode int
+
+const (
+	// RestartNever runs the function once.
+	RestartNever RestartMode = iota
+	// RestartOnFailure runs the function again when it returns an error or
+	// panics.
+	RestartOnFailure
+	// RestartAlways runs the function again whenever it returns.
+	RestartAlways
+)
+
+func (m RestartMode) String() string {
+	switch m {
+	case RestartNever:
+		return "never"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	default:
+		return fmt.Sprintf("RestartMode(%d)", int(m))
+	}
+}
+
+// RestartPolicy configures Supervise.
+type RestartPolicy struct {
+	Mode RestartMode
+	// InitialBackoff is the delay before the first restart. It doubles with
+	// each consecutive restart, up to MaxBackoff, and is reset once a run
+	// lasts longer than MaxBackoff. Defaults to DefaultInitialBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff defaults to DefaultMaxBackoff.
+	MaxBackoff time.Duration
+	// MaxRestarts is how many restarts are allowed within Window before the
+	// supervisor gives up. 0 allows any number of restarts.
+	MaxRestarts int
+	// Window defaults to DefaultRestartWindow.
+	Window time.Duration
+}
+
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute
+	DefaultRestartWindow  = 10 * time.Minute
+)
+
+var (
+	// ErrPanicked is the finish cause of a supervised run, or of a subtask
+	// started with Task.Go, that panicked.
+	ErrPanicked = errors.New("panicked")
+	// ErrTooManyRestarts is the finish cause of a supervisor that gave up
+	// after RestartPolicy.MaxRestarts restarts within RestartPolicy.Window.
+	ErrTooManyRestarts = errors.New("too many restarts")
+)
+
+// Supervise runs fn on a subtask of parent named name, and runs it again on
+// a fresh subtask after it returns or panics, as policy allows. Each run's
+// error or panic becomes the finish cause of its subtask.
+//
+// The returned supervisor task finishes once fn will not be run again:
+// when policy stops it, or when the supervisor or parent is finished, in
+// which case the current run's task is canceled and waited for. Its finish
+// cause is the last failure, if any.
+//
+// Restarts and the final failure are added to the events.History found in
+// the context of parent, if any.
+func Supervise(parent Parent, name string, fn func(*Task) error, policy RestartPolicy) *Task {
+	policy.setDefaults()
+	supervisor := parent.Subtask(name, true)
+	done := make(chan struct{})
+	// keep the supervisor attached until the loop has returned
+	supervisor.OnFinished("supervise", func() { <-done })
+	goLabeled(supervisor, func() {
+		err := supervise(supervisor, fn, policy)
+		close(done)
+		supervisor.Finish(err)
+	})
+	return supervisor
+}
+
+func (policy *RestartPolicy) setDefaults() {
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultInitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultMaxBackoff
+	}
+	if policy.MaxBackoff < policy.InitialBackoff {
+		policy.MaxBackoff = policy.InitialBackoff
+	}
+	if policy.Window <= 0 {
+		policy.Window = DefaultRestartWindow
+	}
+}
+
+// shouldRestart reports whether a run that returned err is run again.
+func (policy *RestartPolicy) shouldRestart(err error) bool {
+	switch policy.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// supervise runs fn until policy stops it or supervisor is canceled, and
+// returns the cause to finish supervisor with.
+func supervise(supervisor *Task, fn func(*Task) error, policy RestartPolicy) error {
+	ctx := supervisor.Context()
+	clock := supervisor.Clock()
+	backoff := policy.InitialBackoff
+	var restarts []time.Time
+
+	for attempt := 1; ; attempt++ {
+		start := clock.Now()
+		err := superviseRun(supervisor, fn)
+		if ctx.Err() != nil {
+			// finished by the owner, not by fn
+			return nil
+		}
+		if !policy.shouldRestart(err) {
+			if err != nil {
+				reportSupervisorFailed(supervisor, attempt, err)
+			}
+			return err
+		}
+
+		now := clock.Now()
+		if now.Sub(start) > policy.MaxBackoff {
+			backoff = policy.InitialBackoff
+		}
+		if policy.MaxRestarts > 0 {
+			restarts = pruneRestarts(restarts, now.Add(-policy.Window))
+			if len(restarts) >= policy.MaxRestarts {
+				err = fmt.Errorf("%w: %d within %s, last error: %w", ErrTooManyRestarts, len(restarts), policy.Window, err)
+				reportSupervisorFailed(supervisor, attempt, err)
+				return err
+			}
+			restarts = append(restarts, now)
+		}
+
+		reportSupervisorRestart(supervisor, attempt, err, backoff)
+		timer := clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+		backoff = min(backoff*2, policy.MaxBackoff)
+	}
+}
+
+// superviseRun runs fn once on a fresh subtask, which is finished with the
+// error fn returns, and waited for.
+func superviseRun(supervisor *Task, fn func(*Task) error) error {
+	run := supervisor.Subtask("run", true)
+	err := callWithRecover(run, func() error { return fn(run) })
+	run.FinishAndWait(err)
+	return err
+}
+
+// pruneRestarts drops the restarts that happened before since.
+func pruneRestarts(restarts []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(restarts) && restarts[i].Before(since) {
+		i++
+	}
+	return restarts[i:]
+}
+
+func reportSupervisorRestart(supervisor *Task, attempt int, err error, backoff time.Duration) {
+	log.Warn().Err(err).Str("task", supervisor.String()).Int("attempt", attempt).Dur("backoff", backoff).Msg("restarting supervised task")
+	if history := events.FromCtx(supervisor.Context()); history != nil {
+		history.Add(events.NewEvent(events.LevelWarn, "task", "restart", map[string]any{
+			"task":    supervisor.String(),
+			"attempt": attempt,
+			"error":   errorString(err),
+			"backoff": backoff.String(),
+		}))
+	}
+}
+
+func reportSupervisorFailed(supervisor *Task, attempt int, err error) {
+	log.Err(err).Str("task", supervisor.String()).Int("attempt", attempt).Msg("supervised task failed")
+	if history := events.FromCtx(supervisor.Context()); history != nil {
+		history.Add(events.NewEvent(events.LevelError, "task", "failed", map[string]any{
+			"task":    supervisor.String(),
+			"attempt": attempt,
+			"error":   err.Error(),
+		}))
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
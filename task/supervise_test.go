@@ -0,0 +1,136 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/goutils/events"
+)
+
+func waitFinished(t *testing.T, task *Task) {
+	t.Helper()
+	select {
+	case <-task.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s did not finish", task)
+	}
+}
+
+func historyActions(history *events.History) []string {
+	var actions []string
+	for _, event := range history.Get() {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+func TestSupervise_RestartOnFailure(t *testing.T) {
+	t.Cleanup(testCleanup)
+	history := events.NewHistory()
+	app := RootTask("app", true)
+	events.SetCtx(app, history)
+
+	testErr := errors.New("test error")
+	var mu sync.Mutex
+	var runs []*Task
+	supervisor := Supervise(app, "worker", func(run *Task) error {
+		mu.Lock()
+		runs = append(runs, run)
+		n := len(runs)
+		mu.Unlock()
+		if n < 3 {
+			return testErr
+		}
+		<-run.Context().Done()
+		return nil
+	}, RestartPolicy{Mode: RestartOnFailure, InitialBackoff: time.Millisecond})
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(runs) == 3
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, "app.worker.run", runs[0].String())
+	assert.NotSame(t, runs[0], runs[1], "each run gets a fresh subtask")
+	assert.ErrorIs(t, runs[0].FinishCause(), testErr)
+	mu.Unlock()
+	assert.Equal(t, []string{"restart", "restart"}, historyActions(history))
+
+	app.FinishAndWait(nil)
+	waitFinished(t, supervisor)
+	assert.ErrorIs(t, supervisor.FinishCause(), context.Canceled)
+	assert.Equal(t, []string{"restart", "restart"}, historyActions(history), "finishing the owner is not a failure")
+}
+
+func TestSupervise_Panic(t *testing.T) {
+	t.Cleanup(testCleanup)
+	history := events.NewHistory()
+	app := RootTask("app", true)
+	events.SetCtx(app, history)
+
+	supervisor := Supervise(app, "worker", func(run *Task) error {
+		panic("boom")
+	}, RestartPolicy{Mode: RestartNever})
+
+	waitFinished(t, supervisor)
+	require.ErrorIs(t, supervisor.FinishCause(), ErrPanicked)
+	assert.Contains(t, supervisor.FinishCause().Error(), "boom")
+	assert.Equal(t, []string{"failed"}, historyActions(history))
+	app.FinishAndWait(nil)
+}
+
+func TestSupervise_MaxRestarts(t *testing.T) {
+	t.Cleanup(testCleanup)
+	history := events.NewHistory()
+	app := RootTask("app", true)
+	events.SetCtx(app, history)
+
+	testErr := errors.New("test error")
+	var runs atomic.Int32
+	supervisor := Supervise(app, "worker", func(run *Task) error {
+		runs.Add(1)
+		return testErr
+	}, RestartPolicy{Mode: RestartOnFailure, InitialBackoff: time.Millisecond, MaxRestarts: 2, Window: time.Minute})
+
+	waitFinished(t, supervisor)
+	assert.Equal(t, int32(3), runs.Load())
+	require.ErrorIs(t, supervisor.FinishCause(), ErrTooManyRestarts)
+	require.ErrorIs(t, supervisor.FinishCause(), testErr)
+	assert.Equal(t, []string{"restart", "restart", "failed"}, historyActions(history))
+	app.FinishAndWait(nil)
+}
+
+func TestSupervise_RestartAlways(t *testing.T) {
+	t.Cleanup(testCleanup)
+	app := RootTask("app", true)
+
+	var runs atomic.Int32
+	supervisor := Supervise(app, "worker", func(run *Task) error {
+		runs.Add(1)
+		return nil
+	}, RestartPolicy{Mode: RestartAlways, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+	supervisor.Finish(nil)
+	waitFinished(t, supervisor)
+	app.FinishAndWait(nil)
+
+	stoppedAt := runs.Load()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, stoppedAt, runs.Load(), "no run after the supervisor finished")
+}
+
+func TestPruneRestarts(t *testing.T) {
+	now := time.Now()
+	restarts := []time.Time{now.Add(-3 * time.Minute), now.Add(-2 * time.Minute), now.Add(-time.Second)}
+	assert.Equal(t, restarts[2:], pruneRestarts(restarts, now.Add(-time.Minute)))
+	assert.Empty(t, pruneRestarts(restarts, now))
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/yusing/goutils/intern"
+	"github.com/yusing/goutils/mockable"
 )
 
 type (
@@ -40,10 +41,20 @@ type (
 		cancel       context.CancelCauseFunc
 		done         chan struct{}
 		finishCalled bool
+		startedAt    time.Time
+		finishedAt   time.Time // when Finish was first called
 		callbacks    *Dependencies[*Callback]
 		children     *Dependencies[*Task]
 
-		values atomic.Pointer[xsync.Map[any, any]]
+		values   atomic.Pointer[xsync.Map[any, any]]
+		observer atomic.Pointer[Observer]
+		clock    atomic.Pointer[mockable.Clock]
+
+		finishTimeout time.Duration      // 0 for taskTimeout
+		onStuck       func(*Task, error) // nil to log the stuck report
+
+		phase      ShutdownPhase
+		dependents []*Task // top-level tasks to finish before this one is canceled
 
 		mu sync.Mutex
 	}
@@ -69,8 +80,24 @@ type (
 		// This method is thread-safe.
 		GetValue(key any) any
 	}
+
+	// Options configures a subtask, see Task.SubtaskWithOptions.
+	Options struct {
+		// NeedFinish is the needFinish argument of Subtask.
+		NeedFinish bool
+		// FinishTimeout is how long Finish and FinishAndWait wait for the
+		// subtask's children and callbacks before giving up. It applies to this
+		// subtask only, not to its own subtasks. While the program is shutting
+		// down it is clamped to the remaining shutdown budget. Defaults to 3s.
+		FinishTimeout time.Duration
+		// OnStuck is called when the subtask gives up waiting for its children
+		// and callbacks, with the reason it gave up, instead of logging the
+		// stuck report. Use Task.Tree to see what is still pending.
+		OnStuck func(t *Task, err error)
+	}
 )
 
+// taskTimeout is the default Options.FinishTimeout.
 const taskTimeout = 3 * time.Second
 
 func (t *Task) Context() context.Context {
@@ -172,7 +199,7 @@ func (t *Task) addCallback(about string, fn func(), wait bool) {
 			for cb := range t.callbacks.Range {
 				if !cb.wait { // Execute non-waiting callbacks (OnCancel)
 					go func(cb *Callback) {
-						invokeWithRecover(cb)
+						invokeWithRecover(t, cb)
 						t.callbacks.Delete(cb)
 					}(cb)
 				}
@@ -183,7 +210,7 @@ func (t *Task) addCallback(about string, fn func(), wait bool) {
 			for cb := range t.callbacks.Range {
 				if cb.wait { // Execute waiting callbacks (OnFinished)
 					go func(cb *Callback) {
-						invokeWithRecover(cb)
+						invokeWithRecover(t, cb)
 						t.callbacks.Delete(cb)
 					}(cb)
 				}
@@ -198,6 +225,12 @@ func (t *Task) addCallback(about string, fn func(), wait bool) {
 //
 // This should not be called after Finish is called on the task or its parent task.
 func (t *Task) Subtask(name string, needFinish bool) *Task {
+	return t.SubtaskWithOptions(name, Options{NeedFinish: needFinish})
+}
+
+// SubtaskWithOptions is like Subtask, with the finish timeout and stuck
+// handling set by opts.
+func (t *Task) SubtaskWithOptions(name string, opts Options) *Task {
 	t.mu.Lock()
 	if t.children == nil {
 		t.children = NewDependencies[*Task]()
@@ -207,15 +240,19 @@ func (t *Task) Subtask(name string, needFinish bool) *Task {
 	}
 
 	child := &Task{
-		name:   intern.Make(name),
-		parent: t,
+		name:          intern.Make(name),
+		parent:        t,
+		finishTimeout: opts.FinishTimeout,
+		onStuck:       opts.OnStuck,
 	}
+	child.clock.Store(t.clock.Load())
+	child.startedAt = child.Clock().Now()
 
 	t.children.Add(child)
 
 	child.ctx, child.cancel = context.WithCancelCause(t.ctx)
 
-	if needFinish {
+	if opts.NeedFinish {
 		child.done = make(chan struct{})
 	} else {
 		child.done = closedCh
@@ -224,7 +261,10 @@ func (t *Task) Subtask(name string, needFinish bool) *Task {
 		})
 	}
 
+	child.observer.Store(t.observer.Load())
+
 	logStarted(child)
+	observeStart(child)
 	return child
 }
 
@@ -233,14 +273,16 @@ func (t *Task) finish(reason any, wait bool) {
 	if t.finishCalled {
 		t.mu.Unlock()
 		// wait but not report stucked (again)
-		_ = t.waitFinish(waitTimeout())
+		_ = t.waitFinish(t.waitTimeout())
 		return
 	}
 
 	t.finishCalled = true
+	t.finishedAt = t.Clock().Now()
 	t.mu.Unlock()
 
 	t.cancel(fmtCause(reason))
+	observeFinishCalled(t)
 
 	if t.needFinish() {
 		// close t.done so onFinish callbacks can be executed
@@ -248,12 +290,13 @@ func (t *Task) finish(reason any, wait bool) {
 	}
 
 	if wait {
-		err := t.waitFinish(waitTimeout())
+		err := t.waitFinish(t.waitTimeout())
 		if err != nil {
-			t.reportStucked(err)
+			t.handleStuck(err, true)
 		}
 		t.detachFromParent(err)
 		logFinished(t)
+		observeFinished(t)
 		return
 	}
 
@@ -262,14 +305,20 @@ func (t *Task) finish(reason any, wait bool) {
 	// could name them. Stay attached until they are done.
 	if t.hasPending() {
 		go func() {
-			t.detachFromParent(t.waitFinish(waitTimeout()))
+			err := t.waitFinish(t.waitTimeout())
+			if err != nil {
+				t.handleStuck(err, false)
+			}
+			t.detachFromParent(err)
 			logFinished(t)
+			observeFinished(t)
 		}()
 		return
 	}
 
 	t.detachFromParent(nil)
 	logFinished(t)
+	observeFinished(t)
 }
 
 // detachFromParent removes the task from its parent's children set now that the
@@ -324,15 +373,19 @@ func (t *Task) waitFinish(timeout time.Duration) error {
 	return nil
 }
 
-// waitTimeout returns how long a single FinishAndWait may wait. While the
-// program is shutting down it never outlasts the program-wide budget, so the
-// root wait is the last one to give up and its report describes what is still
-// stuck rather than what is mid-teardown.
-func waitTimeout() time.Duration {
+// waitTimeout returns how long a single FinishAndWait of t may wait. While
+// the program is shutting down it never outlasts the program-wide budget, so
+// the root wait is the last one to give up and its report describes what is
+// still stuck rather than what is mid-teardown.
+func (t *Task) waitTimeout() time.Duration {
+	timeout := t.finishTimeout
+	if timeout <= 0 {
+		timeout = taskTimeout
+	}
 	if deadline := shutdownDeadline.Load(); deadline != 0 {
-		return min(taskTimeout, time.Until(time.Unix(0, deadline)))
+		return min(timeout, time.Until(time.Unix(0, deadline)))
 	}
-	return taskTimeout
+	return timeout
 }
 
 func (t *Task) fullName() string {
@@ -0,0 +1,245 @@
+package task
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Status describes where a task is in its lifetime.
+type Status string
+
+const (
+	// StatusRunning is a task whose context is not done.
+	StatusRunning Status = "running"
+	// StatusCanceled is a task whose context is done, usually through its
+	// parent, but whose Finish has not been called yet. A needFinish task
+	// that stays canceled is leaking.
+	StatusCanceled Status = "canceled"
+	// StatusFinishing is a task whose Finish has been called but which
+	// still waits for its children or callbacks.
+	StatusFinishing Status = "finishing"
+	// StatusFinished is a task whose Finish has been called and which owns
+	// nothing, but has not been detached from its parent yet.
+	StatusFinished Status = "finished"
+)
+
+// Tree is a point-in-time view of a task and its subtasks, see Task.Tree.
+// Children and callbacks are sorted by name.
+type Tree struct {
+	Name        string        `json:"name"`
+	FullName    string        `json:"full_name"`
+	Age         time.Duration `json:"age"`
+	NeedFinish  bool          `json:"need_finish"`
+	Status      Status        `json:"status"`
+	FinishCause string        `json:"finish_cause,omitempty"`
+	// SinceFinish is how long ago Finish was called, or 0 if it was not.
+	SinceFinish time.Duration `json:"since_finish,omitempty"`
+	// Phase and ShutdownAfter are the shutdown order of a top-level task,
+	// see Task.SetShutdownPhase and Task.DependsOn. Phase is empty for the
+	// default phase.
+	Phase         string   `json:"phase,omitempty"`
+	ShutdownAfter []string `json:"shutdown_after,omitempty"`
+	// OnCancel and OnFinished are the names of the callbacks that have not
+	// returned yet.
+	OnCancel   []string `json:"on_cancel,omitempty"`
+	OnFinished []string `json:"on_finished,omitempty"`
+	Children   []*Tree  `json:"children,omitempty"`
+}
+
+// Snapshot returns the tree of every task started from the root task.
+func Snapshot() *Tree {
+	return root.Tree()
+}
+
+// Tree returns the tree of t and its subtasks. Finished subtasks are
+// included until they are detached from t.
+func (t *Task) Tree() *Tree {
+	return t.tree(t.Clock().Now())
+}
+
+func (t *Task) tree(now time.Time) *Tree {
+	t.mu.Lock()
+	finishCalled := t.finishCalled
+	finishedAt := t.finishedAt
+	callbacks := t.callbacks
+	children := t.children
+	phase, dependents := t.phase, t.dependents
+	t.mu.Unlock()
+
+	tree := &Tree{
+		Name:       t.Name(),
+		FullName:   t.String(),
+		Age:        now.Sub(t.startedAt),
+		NeedFinish: t.needFinish(),
+	}
+	if cause := t.FinishCause(); cause != nil {
+		tree.FinishCause = cause.Error()
+	}
+
+	if finishCalled {
+		tree.SinceFinish = now.Sub(finishedAt)
+	}
+	if phase != PhaseWorkers {
+		tree.Phase = phase.String()
+	}
+	for _, dep := range dependents {
+		tree.ShutdownAfter = append(tree.ShutdownAfter, dep.String())
+	}
+
+	switch {
+	case finishCalled && (callbacks.Len() > 0 || children.Len() > 0):
+		tree.Status = StatusFinishing
+	case finishCalled:
+		tree.Status = StatusFinished
+	case t.ctx.Err() != nil:
+		tree.Status = StatusCanceled
+	default:
+		tree.Status = StatusRunning
+	}
+
+	if callbacks != nil {
+		for cb := range callbacks.Range {
+			if cb.wait {
+				tree.OnFinished = append(tree.OnFinished, cb.about)
+			} else {
+				tree.OnCancel = append(tree.OnCancel, cb.about)
+			}
+		}
+		slices.Sort(tree.OnCancel)
+		slices.Sort(tree.OnFinished)
+	}
+	if children != nil {
+		for child := range children.Range {
+			tree.Children = append(tree.Children, child.tree(now))
+		}
+		slices.SortFunc(tree.Children, func(a, b *Tree) int {
+			return cmp.Compare(a.Name, b.Name)
+		})
+	}
+	return tree
+}
+
+// Walk calls yield for tree and every subtree below it, parents first,
+// until yield returns false.
+func (tree *Tree) Walk(yield func(*Tree) bool) {
+	tree.walk(yield)
+}
+
+func (tree *Tree) walk(yield func(*Tree) bool) bool {
+	if !yield(tree) {
+		return false
+	}
+	for _, child := range tree.Children {
+		if !child.walk(yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stuck returns the subtrees, tree included, whose Finish was called more
+// than after ago but which are still attached to their parent, usually
+// because a callback or a child has not returned yet.
+func (tree *Tree) Stuck(after time.Duration) []*Tree {
+	var stuck []*Tree
+	for t := range tree.Walk {
+		if t.SinceFinish > after {
+			stuck = append(stuck, t)
+		}
+	}
+	return stuck
+}
+
+// WriteJSON writes the tree to w as JSON. Ages are in nanoseconds.
+func (tree *Tree) WriteJSON(w io.Writer) error {
+	return strutils.NewJSONEncoder(w).Encode(tree)
+}
+
+// WriteText writes the tree to w as indented text, one task per line
+// followed by its pending callbacks:
+//
+//	root (running, age 1h0m0s)
+//	  app (finishing, age 1h0m0s, cause: program exiting)
+//	    - on finished: close database
+func (tree *Tree) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	tree.writeText(bw, 0)
+	return bw.Flush()
+}
+
+func (tree *Tree) writeText(w *bufio.Writer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s%s (%s)\n", indent, tree.Name, tree.summary())
+	for _, about := range tree.OnCancel {
+		fmt.Fprintf(w, "%s  - on cancel: %s\n", indent, about)
+	}
+	for _, about := range tree.OnFinished {
+		fmt.Fprintf(w, "%s  - on finished: %s\n", indent, about)
+	}
+	for _, child := range tree.Children {
+		child.writeText(w, depth+1)
+	}
+}
+
+func (tree *Tree) summary() string {
+	summary := string(tree.Status) + ", age " + tree.Age.Round(time.Millisecond).String()
+	if tree.FinishCause != "" {
+		summary += ", cause: " + tree.FinishCause
+	}
+	return summary
+}
+
+// WriteDOT writes the tree to w as a Graphviz DOT digraph. Tasks are boxes,
+// colored orange when canceled and red when finishing, and pending
+// callbacks are dashed ellipses.
+func (tree *Tree) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph tasks {\n\tnode [shape=box];\n")
+	var nextID int
+	tree.writeDOT(bw, &nextID)
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func (tree *Tree) writeDOT(w *bufio.Writer, nextID *int) string {
+	id := fmt.Sprintf("t%d", *nextID)
+	*nextID++
+
+	attrs := ""
+	switch tree.Status {
+	case StatusCanceled:
+		attrs = ", color=orange"
+	case StatusFinishing:
+		attrs = ", color=red"
+	}
+	fmt.Fprintf(w, "\t%s [label=%s%s];\n", id, dotQuote(tree.Name+"\n"+tree.summary()), attrs)
+
+	writeCallbacks := func(kind string, callbacks []string) {
+		for i, about := range callbacks {
+			cbID := fmt.Sprintf("%s_%s%d", id, strings.ReplaceAll(kind, " ", "_"), i)
+			fmt.Fprintf(w, "\t%s [label=%s, shape=ellipse, style=dashed];\n", cbID, dotQuote(about))
+			fmt.Fprintf(w, "\t%s -> %s [label=%s, style=dashed];\n", id, cbID, dotQuote(kind))
+		}
+	}
+	writeCallbacks("on cancel", tree.OnCancel)
+	writeCallbacks("on finished", tree.OnFinished)
+
+	for _, child := range tree.Children {
+		childID := child.writeDOT(w, nextID)
+		fmt.Fprintf(w, "\t%s -> %s;\n", id, childID)
+	}
+	return id
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
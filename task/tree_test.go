@@ -0,0 +1,110 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	app := RootTask("app", true)
+	app.OnCancel("stop listener", func() {})
+	app.OnFinished("close database", func() {})
+	worker := app.Subtask("worker", true)
+	app.Subtask("idle", false)
+
+	release := make(chan struct{})
+	stuck := app.Subtask("stuck", true)
+	stuck.OnFinished("flush", func() { <-release })
+	defer close(release)
+	stuck.Finish(errors.New("shutting down"))
+
+	tree := Snapshot()
+	require.Equal(t, "root", tree.Name)
+	require.Len(t, tree.Children, 1)
+
+	appTree := tree.Children[0]
+	assert.Equal(t, "app", appTree.FullName)
+	assert.True(t, appTree.NeedFinish)
+	assert.Equal(t, StatusRunning, appTree.Status)
+	assert.Equal(t, []string{"stop listener"}, appTree.OnCancel)
+	assert.Equal(t, []string{"close database"}, appTree.OnFinished)
+	require.Len(t, appTree.Children, 3)
+
+	idleTree, stuckTree, workerTree := appTree.Children[0], appTree.Children[1], appTree.Children[2]
+	assert.Equal(t, "app.idle", idleTree.FullName)
+	assert.False(t, idleTree.NeedFinish)
+	assert.Equal(t, StatusFinishing, stuckTree.Status)
+	assert.Equal(t, "shutting down", stuckTree.FinishCause)
+	assert.Equal(t, []string{"flush"}, stuckTree.OnFinished)
+	assert.Equal(t, StatusRunning, workerTree.Status)
+	assert.Positive(t, workerTree.Age)
+
+	app.cancel(nil)
+	assert.Equal(t, StatusCanceled, worker.Tree().Status)
+
+	var names []string
+	for tree := range tree.Walk {
+		names = append(names, tree.FullName)
+	}
+	assert.Equal(t, []string{"root", "app", "app.idle", "app.stuck", "app.worker"}, names)
+}
+
+func TestTreeExport(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	app := RootTask("app", true)
+	app.OnCancel(`stop "listener"`, func() {})
+	app.Subtask("worker", true)
+	tree := app.Tree()
+
+	var buf bytes.Buffer
+	require.NoError(t, tree.WriteJSON(&buf))
+	var decoded Tree
+	require.NoError(t, strutils.UnmarshalJSON(buf.Bytes(), &decoded))
+	assert.Equal(t, tree, &decoded)
+
+	buf.Reset()
+	require.NoError(t, tree.WriteText(&buf))
+	assert.Regexp(t, `^app \(running, age .+\)
+  - on cancel: stop "listener"
+  worker \(running, age .+\)
+$`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, tree.WriteDOT(&buf))
+	dot := buf.String()
+	assert.Contains(t, dot, "digraph tasks {")
+	assert.Contains(t, dot, `t0_on_cancel0 [label="stop \"listener\"", shape=ellipse, style=dashed];`)
+	assert.Contains(t, dot, "t0 -> t1;")
+	assert.Regexp(t, `t1 \[label="worker\\nrunning, age .+"\];`, dot)
+}
+
+func TestTreeStuck(t *testing.T) {
+	t.Cleanup(testCleanup)
+
+	app := RootTask("app", true)
+	release := make(chan struct{})
+	defer close(release)
+	stuck := app.Subtask("stuck", true)
+	stuck.OnFinished("flush", func() { <-release })
+	app.Subtask("worker", true)
+	stuck.Finish(nil)
+
+	tree := app.Tree()
+	assert.Empty(t, tree.Stuck(time.Hour))
+
+	time.Sleep(20 * time.Millisecond)
+	tree = app.Tree()
+	stuckTrees := tree.Stuck(10 * time.Millisecond)
+	require.Len(t, stuckTrees, 1)
+	assert.Equal(t, "app.stuck", stuckTrees[0].FullName)
+	assert.Greater(t, stuckTrees[0].SinceFinish, 10*time.Millisecond)
+}
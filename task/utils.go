@@ -30,12 +30,14 @@ func init() {
 func initRoot() {
 	ctx, cancel := context.WithCancelCause(context.Background())
 	root = &Task{
-		name:   intern.Make("root"),
-		ctx:    ctx,
-		cancel: cancel,
-		done:   closedCh,
+		name:      intern.Make("root"),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      closedCh,
+		startedAt: time.Now(),
 	}
 	root.parent = root
+	shutdownOrdered.Store(false)
 }
 
 func testCleanup() {
@@ -67,6 +69,7 @@ func GetTestTask(tb testing.TB) *Task {
 		cancel:       cancel,
 		done:         closedCh,
 		finishCalled: false,
+		startedAt:    time.Now(),
 	}
 	testTasks[tb] = task
 
@@ -111,40 +114,132 @@ const reportGrace = 100 * time.Millisecond
 // still running when the timeout was reached, and their current tree
 // of subtasks.
 func WaitExit(shutdownTimeout int) {
+	// gracefully shutdown; gracefulShutdown already reported what was left
+	_ = WaitExitWithOptions(ExitOptions{
+		ShutdownTimeout: time.Second * time.Duration(shutdownTimeout),
+	})
+}
+
+// ExitOptions configures WaitExitWithOptions.
+type ExitOptions struct {
+	// ShutdownTimeout is how long to wait for all tasks to finish.
+	ShutdownTimeout time.Duration
+	// Signals are the signals that shut the program down. Defaults to
+	// SIGINT and SIGTERM, and SIGHUP when Reload is nil.
+	Signals []os.Signal
+	// Reload, if set, is called on SIGHUP instead of shutting down. An error
+	// or a panic is logged and the program keeps running.
+	Reload func() error
+	// ForceExit exits the program with status 1 when a second signal
+	// arrives while the tasks are still finishing.
+	ForceExit bool
+}
+
+// osExit is replaced in tests.
+var osExit = os.Exit
+
+// WaitExitWithOptions is like WaitExit, with SIGHUP reloading and forced
+// exits set by opts. It returns the error of the shutdown, which is non-nil
+// when some tasks did not finish in time.
+func WaitExitWithOptions(opts ExitOptions) error {
+	signals := opts.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+		if opts.Reload == nil {
+			signals = append(signals, syscall.SIGHUP)
+		}
+	}
+	if opts.Reload != nil {
+		signals = append(signals, syscall.SIGHUP)
+	}
+
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT)
-	signal.Notify(sig, syscall.SIGTERM)
-	signal.Notify(sig, syscall.SIGHUP)
+	signal.Notify(sig, signals...)
+	defer signal.Stop(sig)
 
+	return waitExit(sig, opts)
+}
+
+func waitExit(sig <-chan os.Signal, opts ExitOptions) error {
 	// wait for signal
-	<-sig
+	s := waitShutdownSignal(sig, opts.Reload)
 
-	// gracefully shutdown; gracefulShutdown already reported what was left
-	log.Info().Msg("shutting down")
-	_ = gracefulShutdown(time.Second * time.Duration(shutdownTimeout))
+	log.Info().Stringer("signal", s).Msg("shutting down")
+	if opts.ForceExit {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for {
+				select {
+				case s := <-sig:
+					if s == syscall.SIGHUP && opts.Reload != nil {
+						continue
+					}
+					log.Warn().Str("signal", s.String()).Msg("received second signal, exiting without waiting for tasks")
+					osExit(1)
+					return
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	return gracefulShutdown(opts.ShutdownTimeout)
+}
+
+// waitShutdownSignal returns the first signal received that is not a SIGHUP
+// handled by reload.
+func waitShutdownSignal(sig <-chan os.Signal, reload func() error) os.Signal {
+	for s := range sig {
+		if s != syscall.SIGHUP || reload == nil {
+			return s
+		}
+		log.Info().Msg("reloading")
+		if err := invokeReload(reload); err != nil {
+			log.Err(err).Msg("reload failed")
+		}
+	}
+	return nil
+}
+
+func invokeReload(reload func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return reload()
 }
 
 // gracefulShutdown waits for all tasks to finish, up to the given timeout.
 //
+// Top-level tasks are canceled in the order set by SetShutdownPhase and
+// DependsOn, if any, then the root task is canceled.
+//
 // If the timeout is exceeded, it prints a list of all tasks that were
 // still running when the timeout was reached, and their current tree
 // of subtasks.
 func gracefulShutdown(timeout time.Duration) error {
-	shutdownDeadline.Store(time.Now().Add(timeout).UnixNano())
+	deadline := time.Now().Add(timeout)
+	shutdownDeadline.Store(deadline.UnixNano())
 	defer shutdownDeadline.Store(0)
 
+	if shutdownOrdered.Load() {
+		cancelInOrder(ErrProgramExiting)
+	}
 	root.Finish(ErrProgramExiting)
-	if err := root.waitFinish(timeout + reportGrace); err != nil {
+	if err := root.waitFinish(time.Until(deadline) + reportGrace); err != nil {
 		root.reportStucked(err)
 		return err
 	}
 	return nil
 }
 
-func invokeWithRecover(cb *Callback) {
+func invokeWithRecover(t *Task, cb *Callback) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Err(fmtCause(err)).Str("callback", cb.about).Msg("panic")
+			observeCallbackPanic(t, cb.about, err)
 			panicWithDebugStack()
 		}
 	}()
@@ -61,3 +61,51 @@ func TestTaskConcurrentSetValue(t *testing.T) {
 		assert.Equal(t, i, task.GetValue(i))
 	}
 }
+
+func TestKey(t *testing.T) {
+	countKey := task.NewKey[int]("count")
+	nameKey := task.NewKey[string]("name")
+
+	parent := task.RootTask("test", false)
+	child := parent.Subtask("child", false)
+
+	_, ok := countKey.Get(child)
+	assert.False(t, ok)
+	assert.Panics(t, func() { countKey.MustGet(child) })
+
+	countKey.Set(parent, 1)
+	nameKey.Set(child, "child")
+	count, ok := countKey.Get(child)
+	assert.True(t, ok)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "child", nameKey.MustGet(child))
+	_, ok = nameKey.Get(parent)
+	assert.False(t, ok)
+
+	name, ok := nameKey.FromContext(child.Context())
+	assert.True(t, ok)
+	assert.Equal(t, "child", name)
+
+	// keys are compared by identity
+	_, ok = task.NewKey[int]("count").Get(child)
+	assert.False(t, ok)
+}
+
+func TestTaskValues(t *testing.T) {
+	countKey := task.NewKey[int]("count")
+
+	parent := task.RootTask("test", false)
+	parent.SetValue("mode", "parent")
+	countKey.Set(parent, 1)
+	child := parent.Subtask("child", false)
+	child.SetValue("mode", "child")
+
+	assert.Equal(t, []task.Value{
+		{Key: "count", Value: 1, Owner: "test"},
+		{Key: "mode", Value: "child", Owner: "test.child"},
+	}, child.Values())
+	assert.Equal(t, []task.Value{
+		{Key: "count", Value: 1, Owner: "test"},
+		{Key: "mode", Value: "parent", Owner: "test"},
+	}, parent.Values())
+}
@@ -0,0 +1,132 @@
+package expect
+
+import (
+	"bytes"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// goroutineSettleTimeout is how long NoGoroutineLeaks waits for the
+// goroutines of a test to exit before reporting them.
+const goroutineSettleTimeout = time.Second
+
+// ignoredGoroutines are functions whose goroutines are not leaks: the test
+// runner, signal handling and the process-wide cache janitor.
+var ignoredGoroutines = []string{
+	"testing.tRunner",
+	"testing.(*T).Run",
+	"testing.runTests",
+	"testing.(*M).",
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"runtime.ensureSigM",
+	"github.com/yusing/goutils/cache.(*statesJanitor).runLoop",
+}
+
+// NoGoroutineLeaks fails t if goroutines started during the test are still
+// running once it and its cleanups are done, with their stacks and, for
+// goroutines started by task helpers such as Task.Go, the name of the task
+// that owns them. Goroutines get up to a second to exit.
+//
+// Call it first in the test, so it checks after the cleanups registered
+// later, such as the ones finishing tasks. Goroutines running a function
+// whose name contains one of ignore are not reported. It cannot tell the
+// goroutines of parallel tests apart, so it should not be used with
+// t.Parallel.
+func NoGoroutineLeaks(t testing.TB, ignore ...string) {
+	t.Helper()
+	before := make(map[string]struct{})
+	for _, g := range goroutines() {
+		before[g.id] = struct{}{}
+	}
+	t.Cleanup(func() {
+		leaked := waitGoroutines(before, ignore, goroutineSettleTimeout)
+		if len(leaked) == 0 {
+			return
+		}
+		var b strings.Builder
+		for _, g := range leaked {
+			b.WriteString("\n\n")
+			b.WriteString(g.String())
+		}
+		t.Errorf("%d goroutines leaked:%s", len(leaked), b.String())
+	})
+}
+
+type goroutine struct {
+	id    string
+	task  string // value of the "task" goroutine label, if any
+	stack string // including the header line
+}
+
+func (g goroutine) String() string {
+	if g.task == "" {
+		return g.stack
+	}
+	return "owned by task " + g.task + "\n" + g.stack
+}
+
+// waitGoroutines polls until every goroutine not in before has exited, or
+// timeout, and returns the ones still running.
+func waitGoroutines(before map[string]struct{}, ignore []string, timeout time.Duration) []goroutine {
+	deadline := time.Now().Add(timeout)
+	for {
+		var leaked []goroutine
+		for _, g := range goroutines() {
+			if _, ok := before[g.id]; !ok && !g.ignored(ignore) {
+				leaked = append(leaked, g)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (g goroutine) ignored(ignore []string) bool {
+	for _, name := range slices.Concat(ignoredGoroutines, ignore) {
+		if strings.Contains(g.stack, name) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	goroutineHeader = regexp.MustCompile(`^goroutine (\d+) \[[^\]]*\]( \{.*\})?:`)
+	taskLabel       = regexp.MustCompile(`[{ ]"?task"?: "?([^,}"]+)"?[,}]`)
+)
+
+// goroutines returns every goroutine, parsed from runtime.Stack.
+func goroutines() []goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var gs []goroutine
+	for stack := range bytes.SplitSeq(buf, []byte("\n\n")) {
+		m := goroutineHeader.FindSubmatch(stack)
+		if m == nil {
+			continue
+		}
+		g := goroutine{id: string(m[1]), stack: string(bytes.TrimSpace(stack))}
+		if labels := m[2]; len(labels) > 0 {
+			if l := taskLabel.FindSubmatch(labels); l != nil {
+				g.task = string(l[1])
+			}
+		}
+		gs = append(gs, g)
+	}
+	return gs
+}
@@ -0,0 +1,52 @@
+package expect
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func snapshotGoroutines() map[string]struct{} {
+	before := make(map[string]struct{})
+	for _, g := range goroutines() {
+		before[g.id] = struct{}{}
+	}
+	return before
+}
+
+func TestWaitGoroutines(t *testing.T) {
+	before := snapshotGoroutines()
+
+	stop := make(chan struct{})
+	started := make(chan struct{})
+	go pprof.Do(context.Background(), pprof.Labels("task", "app.worker 1"), func(context.Context) {
+		close(started)
+		<-stop
+	})
+	<-started
+
+	leaked := waitGoroutines(before, nil, 50*time.Millisecond)
+	require.Len(t, leaked, 1)
+	require.Equal(t, "app.worker 1", leaked[0].task)
+	require.Contains(t, leaked[0].String(), "owned by task app.worker 1\ngoroutine ")
+	require.Contains(t, leaked[0].stack, "TestWaitGoroutines")
+
+	require.Empty(t, waitGoroutines(before, []string{"TestWaitGoroutines.func"}, 0))
+
+	close(stop)
+	require.Empty(t, waitGoroutines(before, nil, time.Second))
+}
+
+func TestNoGoroutineLeaks(t *testing.T) {
+	NoGoroutineLeaks(t)
+
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(done)
+	}()
+	t.Cleanup(func() { <-done })
+}